@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// offsetRange reads FETCH_OFFSET_START and FETCH_OFFSET_END, which restrict a backfill run to
+// the games in [start, end). ok is false when neither is set. Both must lie within IGDB's
+// offset cap, since the range is fetched with offset pagination.
+func offsetRange() (start, end int, ok bool, err error) {
+	startVal, endVal := os.Getenv("FETCH_OFFSET_START"), os.Getenv("FETCH_OFFSET_END")
+	if startVal == "" && endVal == "" {
+		return 0, 0, false, nil
+	}
+	if startVal == "" || endVal == "" {
+		return 0, 0, false, fmt.Errorf("FETCH_OFFSET_START and FETCH_OFFSET_END must be set together")
+	}
+
+	start, err = strconv.Atoi(startVal)
+	if err != nil || start < 0 || start >= igdb.MaxOffset {
+		return 0, 0, false, fmt.Errorf("Invalid FETCH_OFFSET_START %q: must be between 0 and %d", startVal, igdb.MaxOffset-1)
+	}
+	end, err = strconv.Atoi(endVal)
+	if err != nil || end <= start || end > igdb.MaxOffset {
+		return 0, 0, false, fmt.Errorf("Invalid FETCH_OFFSET_END %q: must be greater than FETCH_OFFSET_START and at most %d", endVal, igdb.MaxOffset)
+	}
+	return start, end, true, nil
+}
+
+// backfillKey is the output file a backfill of [start, end) writes its games to.
+func backfillKey(start, end int) string {
+	return fmt.Sprintf("games_backfill_%d_%d.json", start, end)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// checkpointPrefix holds in-progress fetch checkpoints. It sits outside the per-run prefixes
+// so the next run can find the checkpoints of the one that was interrupted.
+const checkpointPrefix = "checkpoints"
+
+// outputCheckpoints is an igdb.CheckpointStore that keeps each entity's checkpoint under
+// checkpoints/<entity>/ on the configured output target: a state.json describing the
+// checkpoint and one numbered file per saved chunk of records.
+type outputCheckpoints struct {
+	ctx context.Context
+}
+
+func checkpointStateKey(entity string) string {
+	return path.Join(checkpointPrefix, entity, "state.json")
+}
+
+func checkpointChunkKey(entity string, i int) string {
+	return path.Join(checkpointPrefix, entity, fmt.Sprintf("chunk-%05d.json", i))
+}
+
+// Load treats an unreadable state file as no checkpoint, since a missing file is the usual case.
+func (c *outputCheckpoints) Load(entity string) (*igdb.Checkpoint, [][]byte, error) {
+	data, err := readOutput(c.ctx, checkpointStateKey(entity))
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	cp := new(igdb.Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, nil, fmt.Errorf("Error decoding checkpoint: %v", err)
+	}
+
+	chunks := make([][]byte, cp.Chunks)
+	for i := range chunks {
+		chunks[i], err = readOutput(c.ctx, checkpointChunkKey(entity, i))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return cp, chunks, nil
+}
+
+// Save writes the chunk before the state that references it, so an interruption in between
+// leaves the previous checkpoint intact.
+func (c *outputCheckpoints) Save(entity string, cp igdb.Checkpoint, chunk []byte) error {
+	if err := writeOutput(c.ctx, checkpointChunkKey(entity, cp.Chunks-1), chunk); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("Error marshaling checkpoint: %v", err)
+	}
+	return writeOutput(c.ctx, checkpointStateKey(entity), data)
+}
+
+// Clear removes the state first, so a partially cleared checkpoint is never resumed.
+func (c *outputCheckpoints) Clear(entity string) error {
+	data, err := readOutput(c.ctx, checkpointStateKey(entity))
+	if err != nil {
+		return nil
+	}
+	var cp igdb.Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return deleteOutput(c.ctx, checkpointStateKey(entity))
+	}
+
+	if err := deleteOutput(c.ctx, checkpointStateKey(entity)); err != nil {
+		return err
+	}
+	for i := range cp.Chunks {
+		if err := deleteOutput(c.ctx, checkpointChunkKey(entity, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/pgzip"
+)
+
+// parallelGzipThreshold is the payload size below which parallel gzip isn't worth its overhead.
+const parallelGzipThreshold = 8 << 20
+
+// gzipData compresses data, splitting the work across workers goroutines with pgzip when
+// workers > 1 and the payload is large enough, otherwise using the standard library writer.
+func gzipData(data []byte, workers int) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	if workers > 1 && len(data) >= parallelGzipThreshold {
+		pw := pgzip.NewWriter(&buf)
+		if err := pw.SetConcurrency(1<<20, workers); err != nil {
+			return nil, err
+		}
+		w = pw
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// missingEnv returns the required environment variables that aren't set. The IGDB
+// credentials aren't required when they come from Secrets Manager or fixtures or injected
+// fetchers replace IGDB, and S3_BUCKET is only required when writing to S3 outside a dry run.
+func missingEnv(offline bool) []string {
+	var missing []string
+	if !offline && os.Getenv("IGDB_CREDENTIALS_SECRET_ARN") == "" && os.Getenv("IGDB_FIXTURE_DIR") == "" {
+		for _, name := range []string{"CLIENT_ID", "CLIENT_SECRET"} {
+			if os.Getenv(name) == "" {
+				missing = append(missing, name)
+			}
+		}
+	}
+	target, _ := outputTarget()
+	if !dryRun() && target == outputTargetS3 && os.Getenv("S3_BUCKET") == "" {
+		missing = append(missing, "S3_BUCKET")
+	}
+	return missing
+}
+
+// validateEnv fails fast, before any API calls, when required configuration is missing. Runs
+// that write to S3 also load the S3 client here, so a missing region fails before fetching.
+// offline runs don't call IGDB and need no credentials.
+func validateEnv(ctx context.Context, offline bool) error {
+	if _, err := outputTarget(); err != nil {
+		return err
+	}
+	if _, err := parseStorageClass(os.Getenv("S3_STORAGE_CLASS")); err != nil {
+		return err
+	}
+	if missing := missingEnv(offline); len(missing) > 0 {
+		return fmt.Errorf("Required environment variables are not set: %s", strings.Join(missing, ", "))
+	}
+	if target, _ := outputTarget(); target == outputTargetS3 && !dryRun() {
+		if _, err := getS3Client(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
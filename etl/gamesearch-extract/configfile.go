@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the optional YAML config for local runs, passed with --config. Each setting
+// overrides the environment variable it corresponds to, and anything left out falls back to
+// the environment.
+type FileConfig struct {
+	// Fields replaces the field list of an entity, like IGDB_FIELDS_<ENTITY>
+	Fields map[string]string `yaml:"fields"`
+	// Workers is IGDB_NUM_WORKERS
+	Workers int `yaml:"workers"`
+	// PageLimit is IGDB_PAGE_LIMIT
+	PageLimit int `yaml:"page_limit"`
+	// OutputDir writes the output to local files under it, like OUTPUT_TARGET=file with OUTPUT_DIR
+	OutputDir string `yaml:"output_dir"`
+}
+
+// loadConfigFile reads and validates a YAML config. Unknown keys are rejected so typos
+// don't silently fall back to the environment.
+func loadConfigFile(name string) (*FileConfig, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config %s: %v", name, err)
+	}
+
+	cfg := new(FileConfig)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("Malformed config %s: %v", name, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config %s: %v", name, err)
+	}
+	return cfg, nil
+}
+
+func (c *FileConfig) validate() error {
+	for entity, fields := range c.Fields {
+		if _, ok := entityFields[entity]; !ok {
+			return fmt.Errorf("fields: unknown entity %q", entity)
+		}
+		if strings.TrimSpace(fields) == "" {
+			return fmt.Errorf("fields: empty field list for %s", entity)
+		}
+	}
+	if c.Workers != 0 && (c.Workers < 1 || c.Workers > igdb.MaxWorkers) {
+		return fmt.Errorf("workers must be between 1 and %d, got %d", igdb.MaxWorkers, c.Workers)
+	}
+	if c.PageLimit != 0 && (c.PageLimit < 1 || c.PageLimit > igdb.MaxPageLimit) {
+		return fmt.Errorf("page_limit must be between 1 and %d, got %d", igdb.MaxPageLimit, c.PageLimit)
+	}
+	return nil
+}
+
+// apply sets the environment variables the config overrides.
+func (c *FileConfig) apply() {
+	for entity, fields := range c.Fields {
+		os.Setenv("IGDB_FIELDS_"+strings.ToUpper(entity), fields)
+	}
+	if c.Workers != 0 {
+		os.Setenv("IGDB_NUM_WORKERS", strconv.Itoa(c.Workers))
+	}
+	if c.PageLimit != 0 {
+		os.Setenv("IGDB_PAGE_LIMIT", strconv.Itoa(c.PageLimit))
+	}
+	if c.OutputDir != "" {
+		os.Setenv("OUTPUT_TARGET", outputTargetFile)
+		os.Setenv("OUTPUT_DIR", c.OutputDir)
+	}
+}
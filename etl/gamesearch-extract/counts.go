@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// countCheck compares how many records each entity fetched with the total IGDB's /count
+// endpoint reported before the fetch started. A nil countCheck is disabled.
+type countCheck struct {
+	logger          *log.Entry
+	maxShortfallPct float64
+
+	mu       sync.Mutex
+	expected map[string]int
+}
+
+func newCountCheck(logger *log.Entry, maxShortfallPct float64) *countCheck {
+	return &countCheck{logger: logger, maxShortfallPct: maxShortfallPct, expected: make(map[string]int)}
+}
+
+// expectCount asks IGDB how many records query matches. A failed count is logged and leaves
+// the entity unchecked rather than failing the run.
+func expectCount[T igdb.Entity](c *countCheck, f *igdb.Fetcher[T], query string) {
+	if c == nil {
+		return
+	}
+
+	count, err := f.Count(query)
+	if err != nil {
+		c.logger.Warnf("Error counting %s, skipping the completeness check: %v", f.Entity(), err)
+		return
+	}
+	c.logger.Infof("IGDB reports %d %s", count, f.Entity())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expected[f.Entity()] = count
+}
+
+// verify logs the expected and fetched counts for entity, warns when fewer records were
+// fetched than IGDB reported, and fails when the shortfall is more than maxShortfallPct of
+// the reported count.
+func (c *countCheck) verify(entity string, fetched int) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	expected, ok := c.expected[entity]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	c.logger.WithFields(log.Fields{"entity": entity, "expected": expected, "fetched": fetched}).Infof("Fetched %d of %d expected %s", fetched, expected, entity)
+	if fetched >= expected {
+		return nil
+	}
+
+	shortfallPct := float64(expected-fetched) / float64(expected) * 100
+	if shortfallPct > c.maxShortfallPct {
+		return fmt.Errorf("Fetched %d of %d %s, %.1f%% short (threshold %.1f%%)", fetched, expected, entity, shortfallPct, c.maxShortfallPct)
+	}
+	c.logger.Warnf("Fetched %d of %d %s", fetched, expected, entity)
+	return nil
+}
+
+// expectedCounts returns the totals IGDB reported, keyed by entity.
+func (c *countCheck) expectedCounts() map[string]int {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.expected)
+}
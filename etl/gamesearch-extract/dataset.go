@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+const (
+	outputModeFiles    = "files"
+	outputModeCombined = "combined"
+)
+
+// parseOutputMode validates OUTPUT_MODE, defaulting to one file per entity.
+func parseOutputMode(value string) (string, error) {
+	switch value {
+	case "":
+		return outputModeFiles, nil
+	case outputModeFiles, outputModeCombined:
+		return value, nil
+	}
+	return "", fmt.Errorf("Invalid OUTPUT_MODE %q: expected files or combined", value)
+}
+
+const (
+	outputFormatJSON   = "json"
+	outputFormatNDJSON = "ndjson"
+)
+
+// parseOutputFormat validates OUTPUT_FORMAT, defaulting to pretty-printed JSON arrays.
+func parseOutputFormat(value string) (string, error) {
+	switch value {
+	case "":
+		return outputFormatJSON, nil
+	case outputFormatJSON, outputFormatNDJSON:
+		return value, nil
+	}
+	return "", fmt.Errorf("Invalid OUTPUT_FORMAT %q: expected json or ndjson", value)
+}
+
+// outputFileName returns the name filename is written under in format, e.g. games.ndjson.
+func outputFileName(filename, format string) string {
+	if format == outputFormatNDJSON {
+		return strings.TrimSuffix(filename, ".json") + ".ndjson"
+	}
+	return filename
+}
+
+// prettyOutput reports whether JSON output is indented, from PRETTY_OUTPUT. Unset, output is
+// indented for local runs and compact in Lambda, where size and transfer matter more.
+func prettyOutput() bool {
+	v := os.Getenv("PRETTY_OUTPUT")
+	if v == "" {
+		return os.Getenv("AWS_LAMBDA_FUNCTION_NAME") == ""
+	}
+	return v == "true"
+}
+
+// marshalOutput encodes value as JSON, indented or compact according to prettyOutput.
+func marshalOutput(value any) ([]byte, error) {
+	if prettyOutput() {
+		return json.MarshalIndent(value, "", "  ")
+	}
+	return json.Marshal(value)
+}
+
+// encodeOutput encodes an output slice as a JSON array, or in ndjson format with one record
+// per line so consumers can process it without loading the whole file.
+func encodeOutput(value any, format string) ([]byte, error) {
+	if format != outputFormatNDJSON {
+		return marshalOutput(value)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	records := reflect.ValueOf(value)
+	for i := range records.Len() {
+		if err := enc.Encode(records.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Dataset is the single object written by OUTPUT_MODE=combined in place of the separate games,
+// genres and franchises files, so consumers never read a half-updated set.
+type Dataset struct {
+	Games      []igdb.Game      `json:"games"`
+	Genres     []igdb.Genre     `json:"genres"`
+	Themes     []igdb.Theme     `json:"themes"`
+	Franchises []igdb.Franchise `json:"franchises"`
+}
+
+func (d Dataset) Len() int {
+	return len(d.Games) + len(d.Genres) + len(d.Themes) + len(d.Franchises)
+}
+
+// recordCount returns the number of records in an output value, which is either a slice or
+// a value with a Len method such as Dataset.
+func recordCount(value any) int {
+	if v, ok := value.(interface{ Len() int }); ok {
+		return v.Len()
+	}
+	return reflect.ValueOf(value).Len()
+}
+
+// sortByID orders records by IGDB ID, so output files don't depend on the order pages
+// arrived in and can be diffed between runs.
+func sortByID[T igdb.Entity](records []T) {
+	slices.SortFunc(records, func(a, b T) int {
+		return cmp.Compare(a.GetID(), b.GetID())
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// fetchInRandomOrder returns games 1 to n in the order a run's pages might complete in.
+func fetchInRandomOrder(n int, seed uint64) []igdb.Game {
+	games := make([]igdb.Game, n)
+	for i := range games {
+		games[i] = igdb.Game{ID: i + 1, Name: "game"}
+	}
+	r := rand.New(rand.NewPCG(seed, seed))
+	r.Shuffle(len(games), func(i, j int) { games[i], games[j] = games[j], games[i] })
+	return games
+}
+
+func TestSortByIDIsStableAcrossRuns(t *testing.T) {
+	t.Setenv("PRETTY_OUTPUT", "true")
+
+	var outputs [][]byte
+	for _, seed := range []uint64{1, 2} {
+		games := fetchInRandomOrder(500, seed)
+		sortByID(games)
+		for i, g := range games {
+			if g.ID != i+1 {
+				t.Fatalf("run %d: game %d has ID %d after sorting", seed, i, g.ID)
+			}
+		}
+
+		data, err := encodeOutput(games, outputFormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("two runs with different page order produced different output")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultEmbeddingsBatchSize = 64
+	defaultEmbeddingsRate      = 1.0
+	embeddingsTimeout          = 60 * time.Second
+)
+
+// embedder calls an OpenAI-compatible embeddings API: a POST of {"model", "input"} that
+// answers with one {"embedding", "index"} per input.
+type embedder struct {
+	http      *http.Client
+	endpoint  string
+	model     string
+	apiKey    string
+	batchSize int
+	limiter   *rate.Limiter
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+// newEmbedder reads EMBEDDINGS_ENDPOINT and EMBEDDINGS_MODEL, both required, plus the optional
+// EMBEDDINGS_API_KEY, EMBEDDINGS_BATCH_SIZE and EMBEDDINGS_RATE (requests per second).
+func newEmbedder() (*embedder, error) {
+	e := &embedder{
+		http:      &http.Client{Timeout: embeddingsTimeout},
+		endpoint:  os.Getenv("EMBEDDINGS_ENDPOINT"),
+		model:     os.Getenv("EMBEDDINGS_MODEL"),
+		apiKey:    os.Getenv("EMBEDDINGS_API_KEY"),
+		batchSize: defaultEmbeddingsBatchSize,
+	}
+	if u, err := url.Parse(e.endpoint); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid EMBEDDINGS_ENDPOINT %q: expected an absolute URL", e.endpoint)
+	}
+	if e.model == "" {
+		return nil, fmt.Errorf("EMBEDDINGS_MODEL is required when EMBEDDINGS_ENABLED is set")
+	}
+
+	if v := os.Getenv("EMBEDDINGS_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid EMBEDDINGS_BATCH_SIZE %q: must be a positive integer", v)
+		}
+		e.batchSize = n
+	}
+
+	r := defaultEmbeddingsRate
+	if v := os.Getenv("EMBEDDINGS_RATE"); v != "" {
+		var err error
+		r, err = strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("Invalid EMBEDDINGS_RATE %q: must be a positive number", v)
+		}
+	}
+	e.limiter = rate.NewLimiter(rate.Limit(r), 1)
+	return e, nil
+}
+
+// embed returns one vector per input, in input order.
+func (e *embedder) embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	if err := e.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: inputs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Embeddings API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var out embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("Error decoding embeddings response: %v", err)
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(inputs) {
+			return nil, fmt.Errorf("Embeddings API returned an out of range index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("Embeddings API returned no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// embeddedSummary is a summary embedded while games were being fetched.
+type embeddedSummary struct {
+	text   string
+	vector []float32
+}
+
+// pageEmbedder embeds the summaries of fetched game pages on its own goroutine, so embedding
+// overlaps the rest of the fetch. Pages are queued without waiting on the embeddings API, so
+// a slow API never holds up the fetch.
+type pageEmbedder struct {
+	e      *embedder
+	logger *log.Entry
+	// input returns the text a game will be embedded with once enriched, and false for games
+	// enrichment drops or leaves without an embedding
+	input func(igdb.Game) (string, bool)
+
+	mu     sync.Mutex
+	queue  []embeddingInput
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+
+	// vectors and failedBatches belong to the embedding goroutine until done is closed
+	vectors       map[int]embeddedSummary
+	failedBatches int
+}
+
+type embeddingInput struct {
+	id   int
+	text string
+}
+
+func startPageEmbedder(ctx context.Context, logger *log.Entry, e *embedder, input func(igdb.Game) (string, bool)) *pageEmbedder {
+	p := &pageEmbedder{
+		e:       e,
+		logger:  logger,
+		input:   input,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		vectors: make(map[int]embeddedSummary),
+	}
+	logger.Infof("Embedding game summaries as pages are fetched, in batches of %d", e.batchSize)
+	go p.run(ctx)
+	return p
+}
+
+// add queues the summaries of a fetched page.
+func (p *pageEmbedder) add(page []igdb.Game) {
+	p.mu.Lock()
+	for _, g := range page {
+		if text, ok := p.input(g); ok {
+			p.queue = append(p.queue, embeddingInput{id: g.ID, text: text})
+		}
+	}
+	p.mu.Unlock()
+	p.notify()
+}
+
+func (p *pageEmbedder) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finish is called once the fetch is done. It waits for the queued summaries to be embedded
+// and returns the embeddings by game ID.
+func (p *pageEmbedder) finish() map[int]embeddedSummary {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.notify()
+	<-p.done
+
+	if p.failedBatches > 0 {
+		p.logger.Warnf("Embedded %d game summaries while fetching, %d batches failed", len(p.vectors), p.failedBatches)
+	} else {
+		p.logger.Infof("Embedded %d game summaries while fetching", len(p.vectors))
+	}
+	return p.vectors
+}
+
+func (p *pageEmbedder) run(ctx context.Context) {
+	defer close(p.done)
+	for {
+		batch := p.next(ctx)
+		if batch == nil {
+			return
+		}
+
+		inputs := make([]string, len(batch))
+		for i, in := range batch {
+			inputs[i] = in.text
+		}
+		vectors, err := p.e.embed(ctx, inputs)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.failedBatches++
+			p.logger.Warnf("Error embedding batch at game %d: %v", batch[0].id, err)
+			continue
+		}
+		for i, in := range batch {
+			p.vectors[in.id] = embeddedSummary{text: in.text, vector: vectors[i]}
+		}
+	}
+}
+
+// next waits for a full batch, or for the last partial one once the fetch is done. It returns
+// nil when there's nothing left to embed or ctx is done.
+func (p *pageEmbedder) next(ctx context.Context) []embeddingInput {
+	for {
+		p.mu.Lock()
+		if len(p.queue) >= p.e.batchSize || p.closed && len(p.queue) > 0 {
+			n := min(p.e.batchSize, len(p.queue))
+			batch := slices.Clone(p.queue[:n])
+			p.queue = p.queue[n:]
+			p.mu.Unlock()
+			return batch
+		}
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-p.wake:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// attachEmbeddings sets TextEmbeddings on every game with a summary, embedding each game's text
+// in batches. Texts already embedded during the fetch, in streamed, are reused when they
+// match. A failed batch is logged and its games are left without embeddings rather than
+// failing the run; only a cancelled context stops the step early.
+func attachEmbeddings(ctx context.Context, logger *log.Entry, e *embedder, games []igdb.Game, text func(igdb.Game) string, streamed map[int]embeddedSummary) {
+	var pending []int
+	reused := 0
+	for i := range games {
+		if strings.TrimSpace(games[i].Summary) == "" || strings.TrimSpace(text(games[i])) == "" {
+			continue
+		}
+		if s, ok := streamed[games[i].ID]; ok && s.text == text(games[i]) {
+			games[i].TextEmbeddings = s.vector
+			reused++
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if reused > 0 {
+		logger.Infof("Using %d embeddings made while fetching", reused)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	logger.Infof("Embedding %d games in batches of %d...", len(pending), e.batchSize)
+
+	embedded, failedBatches := 0, 0
+	for start := 0; start < len(pending); start += e.batchSize {
+		batch := pending[start:min(start+e.batchSize, len(pending))]
+		inputs := make([]string, len(batch))
+		for j, i := range batch {
+			inputs[j] = text(games[i])
+		}
+
+		vectors, err := e.embed(ctx, inputs)
+		if ctx.Err() != nil {
+			logger.Warnf("Embedding stopped early: %v", ctx.Err())
+			break
+		}
+		if err != nil {
+			failedBatches++
+			logger.Warnf("Error embedding batch at game %d: %v", games[batch[0]].ID, err)
+			continue
+		}
+		for j, i := range batch {
+			games[i].TextEmbeddings = vectors[j]
+		}
+		embedded += len(batch)
+	}
+
+	if failedBatches > 0 {
+		logger.Warnf("Embedded %d of %d games, %d batches failed", embedded, len(pending), failedBatches)
+		return
+	}
+	logger.Infof("Embedded %d games", embedded)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+	"golang.org/x/time/rate"
+)
+
+// fakeEmbeddings is an embeddings API whose vector for each input is its length. It reports
+// every request's inputs on requests.
+type fakeEmbeddings struct {
+	requests chan []string
+}
+
+func (s *fakeEmbeddings) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req embeddingRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.requests <- req.Input
+
+	var resp embeddingResponse
+	resp.Data = make([]struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	}, len(req.Input))
+	for i, in := range req.Input {
+		resp.Data[i].Embedding = []float32{float32(len(in))}
+		resp.Data[i].Index = i
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newTestEmbedder(t *testing.T, batchSize int) (*embedder, chan []string) {
+	t.Helper()
+	requests := make(chan []string, 100)
+	srv := httptest.NewServer(&fakeEmbeddings{requests: requests})
+	t.Cleanup(srv.Close)
+	return &embedder{
+		http:      srv.Client(),
+		endpoint:  srv.URL,
+		model:     "test",
+		batchSize: batchSize,
+		limiter:   rate.NewLimiter(rate.Inf, 1),
+	}, requests
+}
+
+func TestPageEmbedderOverlapsFetch(t *testing.T) {
+	e, requests := newTestEmbedder(t, 2)
+	enrichment := &gameEnrichment{embeddings: e, summaryMaxChars: 5}
+	onPage, done := enrichment.embedFetchedPages(context.Background(), log.NewEntry(log.New()))
+
+	onPage([]igdb.Game{{ID: 1, Summary: "one"}, {ID: 2, Summary: "  "}, {ID: 3, Summary: "three words here"}})
+
+	// The first full batch is embedded while the fetch is still going
+	select {
+	case inputs := <-requests:
+		if len(inputs) != 2 || inputs[0] != "one" || inputs[1] != "three" {
+			t.Errorf("first batch = %q, want the summaries of games 1 and 3 as enrichment leaves them", inputs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was embedded before the fetch finished")
+	}
+
+	onPage([]igdb.Game{{ID: 4, Summary: "four"}})
+	done()
+
+	if got := len(enrichment.streamedEmbeddings); got != 3 {
+		t.Fatalf("embedded %d summaries while fetching, want 3", got)
+	}
+	if s := enrichment.streamedEmbeddings[4]; s.text != "four" || s.vector[0] != 4 {
+		t.Errorf("last partial batch embedding = %+v, want game 4's", s)
+	}
+}
+
+func TestAttachEmbeddingsReusesStreamed(t *testing.T) {
+	e, requests := newTestEmbedder(t, 10)
+	games := []igdb.Game{{ID: 1, Summary: "one"}, {ID: 2, Summary: "changed"}, {ID: 3, Summary: "three"}}
+	streamed := map[int]embeddedSummary{
+		1: {text: "one", vector: []float32{42}},
+		2: {text: "original", vector: []float32{42}},
+	}
+
+	text := func(g igdb.Game) string { return g.Summary }
+	attachEmbeddings(context.Background(), log.NewEntry(log.New()), e, games, text, streamed)
+
+	if games[0].TextEmbeddings[0] != 42 {
+		t.Errorf("game 1 embedding = %v, want the streamed one", games[0].TextEmbeddings)
+	}
+	if games[1].TextEmbeddings[0] != float32(len("changed")) || games[2].TextEmbeddings[0] != float32(len("three")) {
+		t.Errorf("embeddings = %v and %v, want games 2 and 3 embedded again", games[1].TextEmbeddings, games[2].TextEmbeddings)
+	}
+
+	close(requests)
+	var embedded []string
+	for inputs := range requests {
+		embedded = append(embedded, inputs...)
+	}
+	if len(embedded) != 2 {
+		t.Errorf("embedded %q, want only the summaries without a matching streamed embedding", embedded)
+	}
+}
+
+func TestApplyEmbedsSearchText(t *testing.T) {
+	e, requests := newTestEmbedder(t, 10)
+	enrichment := &gameEnrichment{embeddings: e, searchText: []string{searchTextName, searchTextSummary}}
+	if onPage, _ := enrichment.embedFetchedPages(context.Background(), log.NewEntry(log.New())); onPage != nil {
+		t.Error("summaries were embedded while fetching although the search text is embedded")
+	}
+
+	games := []igdb.Game{{ID: 1, Name: "One", Summary: "First game"}, {ID: 2, Name: "Two"}}
+	games = enrichment.apply(context.Background(), log.NewEntry(log.New()), games, newNameLookups(nil, nil, nil))
+
+	close(requests)
+	var embedded []string
+	for inputs := range requests {
+		embedded = append(embedded, inputs...)
+	}
+	if len(embedded) != 1 || embedded[0] != games[0].SearchText {
+		t.Errorf("embedded %q, want only the search text of the game with a summary, %q", embedded, games[0].SearchText)
+	}
+	if games[1].TextEmbeddings != nil {
+		t.Error("game without a summary was embedded")
+	}
+}
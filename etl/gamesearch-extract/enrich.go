@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// IGDB external_games category enum values for the storefronts we link to.
+var storeCategories = map[int]string{
+	1:  "steam",
+	5:  "gog",
+	11: "microsoft",
+	13: "apple",
+	15: "android",
+	26: "epic",
+	30: "itch_io",
+	36: "playstation",
+}
+
+func storeLink(eg igdb.ExternalGame) string {
+	if eg.URL != "" {
+		return eg.URL
+	}
+	// Steam listings usually only carry the app ID
+	if eg.Category == 1 && eg.UID != "" {
+		return fmt.Sprintf("https://store.steampowered.com/app/%s", eg.UID)
+	}
+	return ""
+}
+
+// validateGenreIDs checks that every ID refers to one of the fetched genres.
+func validateGenreIDs(ids []int, genres []igdb.Genre) error {
+	known := make(map[int]bool, len(genres))
+	for _, g := range genres {
+		known[g.ID] = true
+	}
+
+	var unknown []int
+	for _, id := range ids {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown genre IDs %v", unknown)
+	}
+	return nil
+}
+
+// attachStoreLinks sets StoreLinks on each game from its external listings, keyed by store.
+// Games with no known store listings are left with a nil map.
+func attachStoreLinks(games []igdb.Game, externalGames []igdb.ExternalGame) {
+	linksByGame := make(map[int]map[string]string)
+	for _, eg := range externalGames {
+		store, ok := storeCategories[eg.Category]
+		if !ok {
+			continue
+		}
+		link := storeLink(eg)
+		if link == "" {
+			continue
+		}
+		if linksByGame[eg.Game] == nil {
+			linksByGame[eg.Game] = make(map[string]string)
+		}
+		linksByGame[eg.Game][store] = link
+	}
+
+	for i := range games {
+		if links, ok := linksByGame[games[i].ID]; ok {
+			games[i].StoreLinks = links
+		}
+	}
+}
+
+// coverURLFormat is the IGDB image CDN URL of a cover in the t_cover_big size.
+const coverURLFormat = "https://images.igdb.com/igdb/image/upload/t_cover_big/%s.jpg"
+
+// dropEmptySummaries removes games whose summary is blank, returning the remaining games and
+// how many were dropped. The order of the remaining games is kept.
+func dropEmptySummaries(games []igdb.Game) ([]igdb.Game, int) {
+	before := len(games)
+	games = slices.DeleteFunc(games, func(g igdb.Game) bool {
+		return strings.TrimSpace(g.Summary) == ""
+	})
+	return games, before - len(games)
+}
+
+// dropLongSummaries removes games whose summary is longer than maxChars characters, returning
+// the remaining games and how many were dropped. The order of the remaining games is kept.
+func dropLongSummaries(games []igdb.Game, maxChars int) ([]igdb.Game, int) {
+	before := len(games)
+	games = slices.DeleteFunc(games, func(g igdb.Game) bool {
+		return utf8.RuneCountInString(g.Summary) > maxChars
+	})
+	return games, before - len(games)
+}
+
+// truncateSummaries cuts every summary longer than maxChars characters back to the last word
+// boundary within the limit, returning how many were truncated. A first word longer than the
+// limit is cut mid-word.
+func truncateSummaries(games []igdb.Game, maxChars int) int {
+	truncated := 0
+	for i := range games {
+		runes := []rune(games[i].Summary)
+		if len(runes) <= maxChars {
+			continue
+		}
+
+		end := maxChars
+		if !unicode.IsSpace(runes[end]) {
+			for j := end - 1; j > 0; j-- {
+				if unicode.IsSpace(runes[j]) {
+					end = j
+					break
+				}
+			}
+		}
+		games[i].Summary = strings.TrimRightFunc(string(runes[:end]), unicode.IsSpace)
+		truncated++
+	}
+	return truncated
+}
+
+// attachCoverURLs sets CoverURL on each game from its cover's image ID. Games without a cover,
+// or whose cover wasn't fetched, keep an empty CoverURL.
+func attachCoverURLs(games []igdb.Game, covers []igdb.Cover) {
+	imageIDs := make(map[int]string, len(covers))
+	for _, c := range covers {
+		imageIDs[c.ID] = c.ImageID
+	}
+
+	for i := range games {
+		if imageID := imageIDs[games[i].Cover]; imageID != "" {
+			games[i].CoverURL = fmt.Sprintf(coverURLFormat, imageID)
+		}
+	}
+}
+
+// attachCompanies sets Developers and Publishers on each game from its involved companies.
+// A company credited with both roles appears in both lists; involvements whose company wasn't
+// fetched are skipped.
+func attachCompanies(games []igdb.Game, involved []igdb.InvolvedCompany, companies []igdb.Company) {
+	names := make(map[int]string, len(companies))
+	for _, c := range companies {
+		names[c.ID] = c.Name
+	}
+
+	byID := make(map[int]igdb.InvolvedCompany, len(involved))
+	for _, ic := range involved {
+		byID[ic.ID] = ic
+	}
+
+	for i := range games {
+		g := &games[i]
+		g.Developers, g.Publishers = nil, nil
+		for _, id := range g.InvolvedCompanies {
+			ic, ok := byID[id]
+			if !ok {
+				continue
+			}
+			name, ok := names[ic.Company]
+			if !ok || name == "" {
+				continue
+			}
+			if ic.Developer {
+				g.Developers = append(g.Developers, name)
+			}
+			if ic.Publisher {
+				g.Publishers = append(g.Publishers, name)
+			}
+		}
+	}
+}
+
+// attachAltNames sets AltNames on each game from its alternative names, skipping blanks and
+// names identical to the game's own. Games without alternative names keep a nil AltNames.
+func attachAltNames(games []igdb.Game, altNames []igdb.AlternativeName) {
+	byID := make(map[int]igdb.AlternativeName, len(altNames))
+	for _, a := range altNames {
+		byID[a.ID] = a
+	}
+
+	for i := range games {
+		g := &games[i]
+		g.AltNames = nil
+		for _, id := range g.AlternativeNames {
+			a, ok := byID[id]
+			if !ok || a.Name == "" || a.Name == g.Name || slices.Contains(g.AltNames, a.Name) {
+				continue
+			}
+			g.AltNames = append(g.AltNames, a.Name)
+		}
+	}
+}
+
+// attachLocalizedTitles sets LocalizedTitles on each game, keyed by region identifier (or
+// region name when IGDB has no identifier). Titles identical to the game's global name add
+// nothing for search and are skipped, as are localizations without a title.
+func attachLocalizedTitles(games []igdb.Game, localizations []igdb.GameLocalization, regions []igdb.Region) {
+	regionKeys := make(map[int]string, len(regions))
+	for _, r := range regions {
+		key := r.Identifier
+		if key == "" {
+			key = r.Name
+		}
+		regionKeys[r.ID] = key
+	}
+
+	byID := make(map[int]igdb.GameLocalization, len(localizations))
+	for _, l := range localizations {
+		byID[l.ID] = l
+	}
+
+	for i := range games {
+		for _, id := range games[i].Localizations {
+			l, ok := byID[id]
+			if !ok || l.Name == "" || l.Name == games[i].Name {
+				continue
+			}
+			region, ok := regionKeys[l.Region]
+			if !ok {
+				continue
+			}
+			if games[i].LocalizedTitles == nil {
+				games[i].LocalizedTitles = make(map[string]string)
+			}
+			games[i].LocalizedTitles[region] = l.Name
+		}
+	}
+}
+
+// nameLookups holds ID to name maps for the reference entities. The maps are built once on
+// first use and are then shared read-only, so concurrent enrichment steps can use them safely.
+type nameLookups struct {
+	genres     []igdb.Genre
+	themes     []igdb.Theme
+	franchises []igdb.Franchise
+
+	once           sync.Once
+	genreNames     map[int]string
+	themeNames     map[int]string
+	franchiseNames map[int]string
+}
+
+func newNameLookups(genres []igdb.Genre, themes []igdb.Theme, franchises []igdb.Franchise) *nameLookups {
+	return &nameLookups{genres: genres, themes: themes, franchises: franchises}
+}
+
+func (l *nameLookups) build() {
+	l.once.Do(func() {
+		l.genreNames = make(map[int]string, len(l.genres))
+		for _, g := range l.genres {
+			l.genreNames[g.ID] = g.Name
+		}
+
+		l.themeNames = make(map[int]string, len(l.themes))
+		for _, t := range l.themes {
+			l.themeNames[t.ID] = t.Name
+		}
+
+		l.franchiseNames = make(map[int]string, len(l.franchises))
+		for _, f := range l.franchises {
+			l.franchiseNames[f.ID] = f.Name
+		}
+	})
+}
+
+func (l *nameLookups) genreName(id int) (string, bool) {
+	l.build()
+	name, ok := l.genreNames[id]
+	return name, ok
+}
+
+func (l *nameLookups) themeName(id int) (string, bool) {
+	l.build()
+	name, ok := l.themeNames[id]
+	return name, ok
+}
+
+func (l *nameLookups) franchiseName(id int) (string, bool) {
+	l.build()
+	name, ok := l.franchiseNames[id]
+	return name, ok
+}
+
+// attachNames sets GenreNames, ThemeNames and FranchiseNames on each game from the fetched
+// genres, themes and franchises. IDs missing from the fetched sets are skipped and logged once
+// per ID.
+func attachNames(logger *log.Entry, games []igdb.Game, lookups *nameLookups) {
+	missingGenres := make(map[int]bool)
+	missingThemes := make(map[int]bool)
+	missingFranchises := make(map[int]bool)
+
+	for i := range games {
+		g := &games[i]
+
+		g.GenreNames = nil
+		for _, id := range g.Genres {
+			if name, ok := lookups.genreName(id); ok {
+				g.GenreNames = append(g.GenreNames, name)
+			} else {
+				missingGenres[id] = true
+			}
+		}
+
+		g.ThemeNames = nil
+		for _, id := range g.Themes {
+			if name, ok := lookups.themeName(id); ok {
+				g.ThemeNames = append(g.ThemeNames, name)
+			} else {
+				missingThemes[id] = true
+			}
+		}
+
+		g.FranchiseNames = nil
+		for _, id := range g.Franchises {
+			if name, ok := lookups.franchiseName(id); ok {
+				g.FranchiseNames = append(g.FranchiseNames, name)
+			} else {
+				missingFranchises[id] = true
+			}
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(missingGenres)) {
+		logger.Warnf("Skipping unknown genre ID %d referenced by games", id)
+	}
+	for _, id := range slices.Sorted(maps.Keys(missingThemes)) {
+		logger.Warnf("Skipping unknown theme ID %d referenced by games", id)
+	}
+	for _, id := range slices.Sorted(maps.Keys(missingFranchises)) {
+		logger.Warnf("Skipping unknown franchise ID %d referenced by games", id)
+	}
+}
+
+// Components that can make up a game's search text.
+const (
+	searchTextName            = "name"
+	searchTextLocalizedTitles = "localized_titles"
+	searchTextAltNames        = "alt_names"
+	searchTextGenres          = "genres"
+	searchTextThemes          = "themes"
+	searchTextFranchises      = "franchises"
+	searchTextSummary         = "summary"
+)
+
+var defaultSearchTextComponents = []string{
+	searchTextName,
+	searchTextLocalizedTitles,
+	searchTextAltNames,
+	searchTextGenres,
+	searchTextThemes,
+	searchTextFranchises,
+	searchTextSummary,
+}
+
+// parseSearchTextComponents parses a comma-separated component list, keeping the given order.
+func parseSearchTextComponents(value string) ([]string, error) {
+	if value == "" {
+		return defaultSearchTextComponents, nil
+	}
+
+	var components []string
+	for _, c := range strings.Split(value, ",") {
+		c = strings.TrimSpace(c)
+		if !slices.Contains(defaultSearchTextComponents, c) {
+			return nil, fmt.Errorf("invalid search text component %q, expected one of %v", c, defaultSearchTextComponents)
+		}
+		components = append(components, c)
+	}
+	return components, nil
+}
+
+func normalizeSearchText(parts []string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.Join(parts, " "))), " ")
+}
+
+// attachSearchText sets SearchText on each game to the configured components joined into a
+// single lowercased, whitespace-collapsed string for keyword and embedding indexes to consume.
+func attachSearchText(games []igdb.Game, lookups *nameLookups, components []string) {
+	for i := range games {
+		g := &games[i]
+
+		var parts []string
+		for _, c := range components {
+			switch c {
+			case searchTextName:
+				parts = append(parts, g.Name)
+			case searchTextLocalizedTitles:
+				for _, region := range slices.Sorted(maps.Keys(g.LocalizedTitles)) {
+					parts = append(parts, g.LocalizedTitles[region])
+				}
+			case searchTextAltNames:
+				parts = append(parts, g.AltNames...)
+			case searchTextGenres:
+				for _, id := range g.Genres {
+					if name, ok := lookups.genreName(id); ok {
+						parts = append(parts, name)
+					}
+				}
+			case searchTextThemes:
+				for _, id := range g.Themes {
+					if name, ok := lookups.themeName(id); ok {
+						parts = append(parts, name)
+					}
+				}
+			case searchTextFranchises:
+				for _, id := range g.Franchises {
+					if name, ok := lookups.franchiseName(id); ok {
+						parts = append(parts, name)
+					}
+				}
+			case searchTextSummary:
+				parts = append(parts, g.Summary)
+			}
+		}
+
+		g.SearchText = normalizeSearchText(parts)
+	}
+}
+
+// gameEnrichment holds the enrichment settings read from the environment. Full runs and
+// refetches both apply it, so a refetched game is stored exactly as a full run would store it.
+type gameEnrichment struct {
+	// summaryMaxChars and summaryDropChars count characters and are off when zero
+	summaryMaxChars, summaryDropChars int
+	resolveNames                      bool
+	// searchText lists the search text components, nil when SEARCH_TEXT is off
+	searchText       []string
+	releaseDateISO   bool
+	skipEmptySummary bool
+	embeddings       *embedder
+	// streamedEmbeddings holds the summaries embedded while games were fetched, by game ID
+	streamedEmbeddings map[int]embeddedSummary
+}
+
+// loadGameEnrichment reads SUMMARY_MAX_CHARS, SUMMARY_DROP_CHARS, RESOLVE_NAMES, SEARCH_TEXT,
+// SEARCH_TEXT_FIELDS, RELEASE_DATE_ISO, SKIP_EMPTY_SUMMARY and the EMBEDDINGS_ settings.
+func loadGameEnrichment() (*gameEnrichment, error) {
+	e := &gameEnrichment{
+		resolveNames:     os.Getenv("RESOLVE_NAMES") == "true",
+		releaseDateISO:   os.Getenv("RELEASE_DATE_ISO") == "true",
+		skipEmptySummary: os.Getenv("SKIP_EMPTY_SUMMARY") == "true",
+	}
+
+	var err error
+	if v := os.Getenv("SUMMARY_MAX_CHARS"); v != "" {
+		e.summaryMaxChars, err = strconv.Atoi(v)
+		if err != nil || e.summaryMaxChars < 1 {
+			return nil, fmt.Errorf("Invalid SUMMARY_MAX_CHARS %q: must be a positive integer", v)
+		}
+	}
+	if v := os.Getenv("SUMMARY_DROP_CHARS"); v != "" {
+		e.summaryDropChars, err = strconv.Atoi(v)
+		if err != nil || e.summaryDropChars < 1 {
+			return nil, fmt.Errorf("Invalid SUMMARY_DROP_CHARS %q: must be a positive integer", v)
+		}
+	}
+
+	if os.Getenv("SEARCH_TEXT") == "true" {
+		if e.searchText, err = parseSearchTextComponents(os.Getenv("SEARCH_TEXT_FIELDS")); err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Getenv("EMBEDDINGS_ENABLED") == "true" {
+		if e.embeddings, err = newEmbedder(); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// needsNames reports whether the enrichment reads genre or franchise names.
+func (e *gameEnrichment) needsNames() bool {
+	return e.resolveNames || slices.ContainsFunc(e.searchText, func(c string) bool {
+		return c == searchTextGenres || c == searchTextThemes || c == searchTextFranchises
+	})
+}
+
+// embedFetchedPages starts embedding summaries from the pages of a games fetch, returning the
+// callback for each page and a function to call once the fetch is done. That function waits
+// for the embedding to finish, and apply then reuses the embeddings. It returns nils when
+// embeddings are off, or embed the search text, which needs names fetched alongside the games.
+func (e *gameEnrichment) embedFetchedPages(ctx context.Context, logger *log.Entry) (onPage func([]igdb.Game), done func()) {
+	if e.embeddings == nil || e.searchText != nil {
+		return nil, nil
+	}
+	p := startPageEmbedder(ctx, logger, e.embeddings, e.embeddingInput)
+	return p.add, func() { e.streamedEmbeddings = p.finish() }
+}
+
+// embeddingInput returns the summary apply will leave g with, and false if apply drops g or
+// leaves it without a summary to embed.
+func (e *gameEnrichment) embeddingInput(g igdb.Game) (string, bool) {
+	if e.summaryDropChars > 0 && utf8.RuneCountInString(g.Summary) > e.summaryDropChars {
+		return "", false
+	}
+	if e.summaryMaxChars > 0 {
+		games := []igdb.Game{{Summary: g.Summary}}
+		truncateSummaries(games, e.summaryMaxChars)
+		g.Summary = games[0].Summary
+	}
+	return g.Summary, strings.TrimSpace(g.Summary) != ""
+}
+
+// embeddingText returns the text apply embeds for g: its search text when SEARCH_TEXT is on, so
+// embedding and keyword search represent a game by the same text, and its summary otherwise.
+func (e *gameEnrichment) embeddingText(g igdb.Game) string {
+	if e.searchText != nil {
+		return g.SearchText
+	}
+	return g.Summary
+}
+
+// apply enriches games, whose linked records are already attached, and returns the games that
+// are kept. Oversized summaries are dropped by their original length and the rest truncated
+// before search text and embeddings are built from them; empty summaries are filtered after
+// the other steps so the games that are kept are enriched exactly as before.
+func (e *gameEnrichment) apply(ctx context.Context, logger *log.Entry, games []igdb.Game, lookups *nameLookups) []igdb.Game {
+	if e.summaryDropChars > 0 {
+		var dropped int
+		games, dropped = dropLongSummaries(games, e.summaryDropChars)
+		logger.Infof("Dropped %d games with a summary over %d characters", dropped, e.summaryDropChars)
+	}
+	if e.summaryMaxChars > 0 {
+		truncated := truncateSummaries(games, e.summaryMaxChars)
+		logger.Infof("Truncated %d game summaries to %d characters", truncated, e.summaryMaxChars)
+	}
+
+	if e.resolveNames {
+		attachNames(logger, games, lookups)
+	}
+	if e.searchText != nil {
+		attachSearchText(games, lookups, e.searchText)
+	}
+	if e.releaseDateISO {
+		attachReleaseDateISO(games)
+	}
+
+	if e.skipEmptySummary {
+		var dropped int
+		games, dropped = dropEmptySummaries(games)
+		logger.Infof("Dropped %d games with an empty summary", dropped)
+	}
+
+	if e.embeddings != nil {
+		attachEmbeddings(ctx, logger, e.embeddings, games, e.embeddingText, e.streamedEmbeddings)
+	}
+	return games
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+func TestAttachSearchTextThemes(t *testing.T) {
+	lookups := newNameLookups(
+		[]igdb.Genre{{ID: 12, Name: "Role-playing (RPG)"}},
+		[]igdb.Theme{{ID: 1, Name: "Action"}, {ID: 19, Name: "Horror"}},
+		[]igdb.Franchise{{ID: 3, Name: "Souls"}},
+	)
+	games := []igdb.Game{{ID: 1, Name: "Bloodborne", Genres: []int{12}, Themes: []int{1, 19, 99}, Franchises: []int{3}}}
+
+	components, err := parseSearchTextComponents("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachSearchText(games, lookups, components)
+	if want := "bloodborne role-playing (rpg) action horror souls"; games[0].SearchText != want {
+		t.Errorf("search text = %q, want %q", games[0].SearchText, want)
+	}
+
+	attachSearchText(games, lookups, []string{searchTextThemes})
+	if want := "action horror"; games[0].SearchText != want {
+		t.Errorf("themes-only search text = %q, want %q", games[0].SearchText, want)
+	}
+}
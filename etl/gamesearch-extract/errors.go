@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// checkFetchErrors fails the run when any entity lost more than maxFailedPct of its pages.
+// Failures within the threshold are logged and the partial results are kept.
+func checkFetchErrors(logger *log.Entry, errs []error, maxFailedPct float64) error {
+	var fatal []error
+	for _, err := range errs {
+		var fetchErr *igdb.FetchError
+		if !errors.As(err, &fetchErr) {
+			if err != nil {
+				fatal = append(fatal, err)
+			}
+			continue
+		}
+
+		// An incomplete fetch is missing an unknown number of pages, so no percentage covers it
+		failedPct := float64(fetchErr.Failed) / float64(fetchErr.Pages) * 100
+		if fetchErr.Incomplete || failedPct > maxFailedPct {
+			fatal = append(fatal, err)
+		} else {
+			logger.Warnf("Keeping partial results: %v", err)
+		}
+	}
+
+	if len(fatal) > 0 {
+		return fmt.Errorf("Too many pages failed to fetch (threshold %.1f%%): %w", maxFailedPct, errors.Join(fatal...))
+	}
+	return nil
+}
+
+// failedPages returns the number of failed pages reported by a *igdb.FetchError, or 0.
+func failedPages(err error) int {
+	var fetchErr *igdb.FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Failed
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+func TestCheckFetchErrorsRejectsIncompleteFetch(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	lost := &igdb.FetchError{Entity: "games", Pages: 100, Failed: 1, Offsets: []int{500}, Err: errors.New("boom")}
+
+	if err := checkFetchErrors(logger, []error{lost}, 5); err != nil {
+		t.Fatalf("1%% failed pages under a 5%% threshold: %v", err)
+	}
+	lost.Incomplete = true
+	if err := checkFetchErrors(logger, []error{lost}, 5); err == nil {
+		t.Fatal("an incomplete fetch passed the failed page threshold")
+	}
+}
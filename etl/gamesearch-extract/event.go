@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// eventEntities are the entities an event can restrict a run to.
+var eventEntities = []string{"genres", "themes", "games", "franchises", "covers", "platforms"}
+
+// gameLookups are the entities games are enriched from: genre, theme and franchise names for
+// the resolved names and the search text. Covers aren't among them since a restricted run
+// fetches only the covers its games reference.
+var gameLookups = []string{"genres", "themes", "franchises"}
+
+// runOptions are per-invocation settings taken from the event rather than the environment.
+type runOptions struct {
+	// Prefix replaces OUTPUT_PREFIX and the timestamp prefix when set.
+	Prefix string
+	// Entities restricts the run to these entities; empty fetches all of them.
+	Entities []string
+	// PageLimit replaces IGDB_PAGE_LIMIT when set.
+	PageLimit int
+	// Fetchers replaces the fetchers of the endpoints it sets, e.g. with fakes that return
+	// canned records. A run with injected fetchers doesn't call IGDB: other entities come from
+	// IGDB_FIXTURE_DIR when it's set and fail otherwise.
+	Fetchers Fetchers
+
+	// fixtures is IGDB_FIXTURE_DIR, set by fetchAndStoreData
+	fixtures string
+}
+
+// fetches reports whether the run includes entity.
+func (o runOptions) fetches(entity string) bool {
+	return len(o.Entities) == 0 || slices.Contains(o.Entities, entity)
+}
+
+// offline reports whether the run reads entities from fixtures or injected fetchers instead of
+// IGDB.
+func (o runOptions) offline() bool {
+	return o.fixtures != "" || len(o.Fetchers.endpoints()) > 0
+}
+
+// partial reports whether the run leaves out some entities.
+func (o runOptions) partial() bool {
+	return len(o.Entities) > 0
+}
+
+// eventBridgeEnvelope is the wrapper EventBridge puts around events it delivers from a rule,
+// with the event's own payload under detail.
+type eventBridgeEnvelope struct {
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// decodeEvent parses the invocation payload. A schedule with constant input delivers the Event
+// as is, while an EventBridge rule wraps it in an envelope, so the Event is read from detail
+// when the payload is one. A payload that isn't a valid Event, including one with fields an
+// Event doesn't have, is an error, so a malformed override never turns into a full fetch.
+func decodeEvent(logger *log.Entry, raw json.RawMessage) (Event, error) {
+	var evt Event
+	if len(raw) == 0 {
+		return evt, nil
+	}
+
+	var envelope eventBridgeEnvelope
+	if err := json.Unmarshal(raw, &envelope); err == nil && envelope.DetailType != "" {
+		detail := bytes.TrimSpace(envelope.Detail)
+		if len(detail) == 0 || bytes.Equal(detail, []byte("null")) {
+			return evt, fmt.Errorf("Invalid event: %q EventBridge event has no detail", envelope.DetailType)
+		}
+		logger.Infof("Reading overrides from the detail of a %q EventBridge event", envelope.DetailType)
+		raw = detail
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&evt); err != nil {
+		return evt, fmt.Errorf("Invalid event: %v", err)
+	}
+	return evt, nil
+}
+
+// eventOptions validates the event's per-run overrides and logs the ones that apply. An
+// event without overrides yields the zero runOptions, a full fetch with the usual settings.
+func eventOptions(logger *log.Entry, evt Event) (runOptions, error) {
+	var opts runOptions
+
+	for _, entity := range evt.Entities {
+		if !slices.Contains(eventEntities, entity) {
+			return opts, fmt.Errorf("Invalid entity %q in event: expected one of %v", entity, eventEntities)
+		}
+		if !slices.Contains(opts.Entities, entity) {
+			opts.Entities = append(opts.Entities, entity)
+		}
+	}
+	if slices.Contains(opts.Entities, "games") {
+		// A restricted run would otherwise write games without their genre names and genre
+		// search text
+		var added []string
+		for _, entity := range gameLookups {
+			if !slices.Contains(opts.Entities, entity) {
+				opts.Entities = append(opts.Entities, entity)
+				added = append(added, entity)
+			}
+		}
+		if len(added) > 0 {
+			logger.Infof("Event override: also fetching %v, which games are enriched from", added)
+		}
+	}
+	if len(opts.Entities) > 0 {
+		logger.Infof("Event override: fetching only %v", opts.Entities)
+	}
+
+	if evt.PageLimit != 0 {
+		if evt.PageLimit < 1 || evt.PageLimit > igdb.MaxPageLimit {
+			return opts, fmt.Errorf("Invalid page_limit %d in event: must be between 1 and %d", evt.PageLimit, igdb.MaxPageLimit)
+		}
+		opts.PageLimit = evt.PageLimit
+		logger.Infof("Event override: page limit %d", opts.PageLimit)
+	}
+
+	if evt.OutputPrefix != "" {
+		prefix, err := keyPrefix("output_prefix", evt.OutputPrefix)
+		if err != nil {
+			return opts, err
+		}
+		opts.Prefix = prefix
+		logger.Infof("Event override: output prefix %s", opts.Prefix)
+	}
+	return opts, nil
+}
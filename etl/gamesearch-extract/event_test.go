@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		entities []string
+		wantErr  bool
+	}{
+		{"empty payload", "", nil, false},
+		{"direct event", `{"entities":["genres"]}`, []string{"genres"}, false},
+		{"EventBridge envelope", `{"detail-type":"Refresh","detail":{"entities":["games"]}}`, []string{"games"}, false},
+		{"mistyped entities", `{"entities":"games"}`, nil, true},
+		{"mistyped detail", `{"detail-type":"Refresh","detail":{"entities":"games"}}`, nil, true},
+		{"malformed JSON", `{"entities":[`, nil, true},
+		{"scheduled EventBridge event", `{"detail-type":"Scheduled Event","source":"aws.events","detail":{}}`, nil, false},
+		{"envelope without detail", `{"detail-type":"Refresh","source":"aws.events"}`, nil, true},
+		{"envelope with null detail", `{"detail-type":"Refresh","detail":null}`, nil, true},
+		{"unknown field", `{"entitys":["games"]}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt, err := decodeEvent(log.NewEntry(log.New()), json.RawMessage(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeEvent error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(evt.Entities, tt.entities) {
+				t.Errorf("entities = %v, want %v", evt.Entities, tt.entities)
+			}
+		})
+	}
+}
+
+func TestEventOptionsGamesFetchLookups(t *testing.T) {
+	tests := []struct {
+		entities []string
+		want     []string
+	}{
+		{[]string{"games"}, []string{"games", "genres", "themes", "franchises"}},
+		{[]string{"covers", "games"}, []string{"covers", "games", "genres", "themes", "franchises"}},
+		{[]string{"genres"}, []string{"genres"}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		opts, err := eventOptions(log.NewEntry(log.New()), Event{Entities: tt.entities})
+		if err != nil {
+			t.Fatalf("eventOptions(%v): %v", tt.entities, err)
+		}
+		if !slices.Equal(opts.Entities, tt.want) {
+			t.Errorf("eventOptions(%v) entities = %v, want %v", tt.entities, opts.Entities, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// fixtureSource is an igdb.PageFetcher that reads an entity from <dir>/<entity>.json, a file in the same format as the
+// extractor's output, instead of calling IGDB. Queries are ignored, so filters don't apply.
+type fixtureSource[T igdb.Entity] struct {
+	dir    string
+	entity string
+	client *igdb.Client
+}
+
+func (s *fixtureSource[T]) FetchAll(query string, numWorkers, pageLimit int) ([]T, error) {
+	start := time.Now()
+	records, err := s.load()
+	if s.client.Recorder != nil {
+		s.client.Recorder.RecordFetch(s.entity, len(records), 0, false, time.Since(start), err)
+	}
+	return records, err
+}
+
+// load decodes the fixture file. A missing file is logged and treated as no records, so
+// fixtures only need to cover the entities being worked on.
+func (s *fixtureSource[T]) load() ([]T, error) {
+	name := filepath.Join(s.dir, s.entity+".json")
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		s.client.Logger.Warnf("No %s fixture at %s, using no records", s.entity, name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading fixture %s: %v", name, err)
+	}
+
+	var records []T
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("Error decoding fixture %s: %v", name, err)
+	}
+	if m := s.client.MaxRecords; m > 0 && len(records) > m {
+		records = records[:m]
+	}
+	s.client.Logger.Infof("Loaded %d %s from fixture %s", len(records), s.entity, name)
+	return records, nil
+}
+
+// fixtureDir returns IGDB_FIXTURE_DIR, checking that it is a directory.
+func fixtureDir() (string, error) {
+	dir := os.Getenv("IGDB_FIXTURE_DIR")
+	if dir == "" {
+		return "", nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Invalid IGDB_FIXTURE_DIR %q: not a directory", dir)
+	}
+	return dir, nil
+}
+
+// Fetchers holds the fetchers injected for a run, one per endpoint that goes through
+// pageFetcher. A nil field leaves the endpoint's usual fetcher in place.
+type Fetchers struct {
+	Genres            igdb.PageFetcher[igdb.Genre]
+	Themes            igdb.PageFetcher[igdb.Theme]
+	Games             igdb.PageFetcher[igdb.Game]
+	Franchises        igdb.PageFetcher[igdb.Franchise]
+	Covers            igdb.PageFetcher[igdb.Cover]
+	Platforms         igdb.PageFetcher[igdb.Platform]
+	ExternalGames     igdb.PageFetcher[igdb.ExternalGame]
+	Regions           igdb.PageFetcher[igdb.Region]
+	GameLocalizations igdb.PageFetcher[igdb.GameLocalization]
+	AlternativeNames  igdb.PageFetcher[igdb.AlternativeName]
+	Companies         igdb.PageFetcher[igdb.Company]
+	InvolvedCompanies igdb.PageFetcher[igdb.InvolvedCompany]
+}
+
+// endpoints returns the endpoints with an injected fetcher.
+func (f Fetchers) endpoints() []string {
+	var set []string
+	for _, e := range []struct {
+		name    string
+		fetcher any
+	}{
+		{"genres", f.Genres}, {"themes", f.Themes}, {"games", f.Games}, {"franchises", f.Franchises},
+		{"covers", f.Covers}, {"platforms", f.Platforms}, {"external_games", f.ExternalGames},
+		{"regions", f.Regions}, {"game_localizations", f.GameLocalizations},
+		{"alternative_names", f.AlternativeNames}, {"companies", f.Companies},
+		{"involved_companies", f.InvolvedCompanies},
+	} {
+		if e.fetcher != nil {
+			set = append(set, e.name)
+		}
+	}
+	return set
+}
+
+// injectedFetcher returns the fetcher injected for T's endpoint, or nil.
+func injectedFetcher[T igdb.Entity](f Fetchers) igdb.PageFetcher[T] {
+	var fetcher any
+	switch any(*new(T)).(type) {
+	case igdb.Genre:
+		fetcher = f.Genres
+	case igdb.Theme:
+		fetcher = f.Themes
+	case igdb.Game:
+		fetcher = f.Games
+	case igdb.Franchise:
+		fetcher = f.Franchises
+	case igdb.Cover:
+		fetcher = f.Covers
+	case igdb.Platform:
+		fetcher = f.Platforms
+	case igdb.ExternalGame:
+		fetcher = f.ExternalGames
+	case igdb.Region:
+		fetcher = f.Regions
+	case igdb.GameLocalization:
+		fetcher = f.GameLocalizations
+	case igdb.AlternativeName:
+		fetcher = f.AlternativeNames
+	case igdb.Company:
+		fetcher = f.Companies
+	case igdb.InvolvedCompany:
+		fetcher = f.InvolvedCompanies
+	}
+	injected, _ := fetcher.(igdb.PageFetcher[T])
+	return injected
+}
+
+// missingSource is the igdb.PageFetcher of an entity with no injected fetcher in a run that
+// doesn't call IGDB.
+type missingSource[T igdb.Entity] struct {
+	entity string
+}
+
+func (s missingSource[T]) FetchAll(string, int, int) ([]T, error) {
+	return nil, fmt.Errorf("No fetcher injected for %s and IGDB_FIXTURE_DIR isn't set", s.entity)
+}
+
+// pageFetcher returns what the run fetches f's entity through: the fetcher injected for it in
+// opts.Fetchers, fixtures when IGDB_FIXTURE_DIR is set, and f itself otherwise. Fixture loads
+// are logged and recorded through client.
+func pageFetcher[T igdb.Entity](opts runOptions, client *igdb.Client, f *igdb.Fetcher[T]) igdb.PageFetcher[T] {
+	if injected := injectedFetcher[T](opts.Fetchers); injected != nil {
+		return injected
+	}
+	if opts.fixtures != "" {
+		return &fixtureSource[T]{dir: opts.fixtures, entity: f.Entity(), client: client}
+	}
+	if opts.offline() {
+		return missingSource[T]{entity: f.Entity()}
+	}
+	return f
+}
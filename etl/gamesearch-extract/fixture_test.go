@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// cannedFetcher is an injected igdb.PageFetcher returning fixed records.
+type cannedFetcher[T igdb.Entity] []T
+
+func (f cannedFetcher[T]) FetchAll(string, int, int) ([]T, error) {
+	return slices.Clone(f), nil
+}
+
+// setOfflineEnv points the run's output at a temporary directory, with no IGDB credentials.
+func setOfflineEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("OUTPUT_TARGET", "file")
+	t.Setenv("OUTPUT_DIR", t.TempDir())
+	for _, name := range []string{"CLIENT_ID", "CLIENT_SECRET", "IGDB_CREDENTIALS_SECRET_ARN", "IGDB_FIXTURE_DIR"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestFetchAndStoreDataWithInjectedFetchers(t *testing.T) {
+	setOfflineEnv(t)
+	t.Setenv("RESOLVE_NAMES", "true")
+	ctx := context.Background()
+
+	opts := runOptions{Prefix: "injected", Fetchers: Fetchers{
+		Genres:     cannedFetcher[igdb.Genre]{{ID: 12, Name: "RPG"}},
+		Themes:     cannedFetcher[igdb.Theme]{{ID: 19, Name: "Horror"}},
+		Games:      cannedFetcher[igdb.Game]{{ID: 2, Name: "Two", Genres: []int{12}, Themes: []int{19}, Cover: 7}, {ID: 1, Name: "One"}},
+		Franchises: cannedFetcher[igdb.Franchise]{},
+		Covers:     cannedFetcher[igdb.Cover]{{ID: 7, ImageID: "abc"}},
+		Platforms:  cannedFetcher[igdb.Platform]{},
+	}}
+	if _, err := fetchAndStoreData(ctx, log.NewEntry(log.New()), "run", opts); err != nil {
+		t.Fatalf("fetchAndStoreData: %v", err)
+	}
+
+	manifest, err := readManifest(ctx, path.Join("injected", manifestKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.SummaryKey != "injected/run_summary.json" {
+		t.Errorf("summary key = %q, want it under the run's prefix", manifest.SummaryKey)
+	}
+	if _, err := readOutput(ctx, manifest.SummaryKey); err != nil {
+		t.Errorf("run summary wasn't written: %v", err)
+	}
+	data, err := readOutput(ctx, manifest.Keys["games.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var games []igdb.Game
+	if err := json.Unmarshal(data, &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 || games[0].ID != 1 || games[1].ID != 2 {
+		t.Fatalf("games = %+v, want IDs 1 and 2 in order", games)
+	}
+	if g := games[1]; !slices.Equal(g.GenreNames, []string{"RPG"}) || !slices.Equal(g.ThemeNames, []string{"Horror"}) || !strings.Contains(g.CoverURL, "abc") {
+		t.Errorf("injected game wasn't enriched: %+v", g)
+	}
+}
+
+func TestFetchAndStoreDataNeedsFetcherForEachEntity(t *testing.T) {
+	setOfflineEnv(t)
+	opts := runOptions{Fetchers: Fetchers{Genres: cannedFetcher[igdb.Genre]{}}}
+	_, err := fetchAndStoreData(context.Background(), log.NewEntry(log.New()), "run", opts)
+	if err == nil || !strings.Contains(err.Error(), "No fetcher injected") {
+		t.Fatalf("fetchAndStoreData error = %v, want one about the entities without a fetcher", err)
+	}
+}
+
+// fetchTracker records the order injected fetches start in and how many overlap.
+type fetchTracker struct {
+	mu         sync.Mutex
+	order      []string
+	inFlight   int
+	maxOverlap int
+}
+
+// trackedFetcher is an injected igdb.PageFetcher that reports its fetch to a fetchTracker.
+type trackedFetcher[T igdb.Entity] struct {
+	entity  string
+	tracker *fetchTracker
+}
+
+func (f trackedFetcher[T]) FetchAll(string, int, int) ([]T, error) {
+	t := f.tracker
+	t.mu.Lock()
+	t.order = append(t.order, f.entity)
+	t.inFlight++
+	t.maxOverlap = max(t.maxOverlap, t.inFlight)
+	t.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	t.mu.Lock()
+	t.inFlight--
+	t.mu.Unlock()
+	return nil, nil
+}
+
+func TestDeterministicFetchIsSequential(t *testing.T) {
+	setOfflineEnv(t)
+	t.Setenv("DETERMINISTIC_FETCH", "true")
+
+	tracker := &fetchTracker{}
+	opts := runOptions{Fetchers: Fetchers{
+		Genres:     trackedFetcher[igdb.Genre]{"genres", tracker},
+		Themes:     trackedFetcher[igdb.Theme]{"themes", tracker},
+		Games:      trackedFetcher[igdb.Game]{"games", tracker},
+		Franchises: trackedFetcher[igdb.Franchise]{"franchises", tracker},
+		Covers:     trackedFetcher[igdb.Cover]{"covers", tracker},
+		Platforms:  trackedFetcher[igdb.Platform]{"platforms", tracker},
+	}}
+	if _, err := fetchAndStoreData(context.Background(), log.NewEntry(log.New()), "run", opts); err != nil {
+		t.Fatalf("fetchAndStoreData: %v", err)
+	}
+
+	if tracker.maxOverlap != 1 {
+		t.Errorf("%d fetches ran at once, want 1", tracker.maxOverlap)
+	}
+	want := []string{"genres", "games", "franchises", "themes", "covers", "platforms"}
+	if !slices.Equal(tracker.order, want) {
+		t.Errorf("fetch order = %v, want %v", tracker.order, want)
+	}
+}
+
+// queryFetcher is an injected igdb.PageFetcher that records the queries it's given.
+type queryFetcher[T igdb.Entity] struct {
+	records []T
+	queries *[]string
+}
+
+func (f queryFetcher[T]) FetchAll(query string, _, _ int) ([]T, error) {
+	*f.queries = append(*f.queries, query)
+	return slices.Clone(f.records), nil
+}
+
+func TestGamesRunFetchesOnlyReferencedCovers(t *testing.T) {
+	setOfflineEnv(t)
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	opts, err := eventOptions(logger, Event{Entities: []string{"games"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	opts.Prefix = "games"
+	opts.Fetchers = Fetchers{
+		Genres:     cannedFetcher[igdb.Genre]{},
+		Themes:     cannedFetcher[igdb.Theme]{},
+		Games:      cannedFetcher[igdb.Game]{{ID: 1, Cover: 7}, {ID: 2}, {ID: 3, Cover: 9}},
+		Franchises: cannedFetcher[igdb.Franchise]{},
+		Covers:     queryFetcher[igdb.Cover]{[]igdb.Cover{{ID: 7, ImageID: "abc"}, {ID: 9, ImageID: "def"}}, &queries},
+	}
+	if _, err := fetchAndStoreData(ctx, logger, "run", opts); err != nil {
+		t.Fatalf("fetchAndStoreData: %v", err)
+	}
+
+	if len(queries) != 1 || !strings.Contains(queries[0], "where id = (7,9);") {
+		t.Errorf("covers queries = %q, want one restricted to covers 7 and 9", queries)
+	}
+	manifest, err := readManifest(ctx, path.Join("games", manifestKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Keys["covers.json"]; ok {
+		t.Error("the games run wrote the covers it fetched for its games")
+	}
+	data, err := readOutput(ctx, manifest.Keys["games.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var games []igdb.Game
+	if err := json.Unmarshal(data, &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 3 || !strings.Contains(games[0].CoverURL, "abc") || !strings.Contains(games[2].CoverURL, "def") {
+		t.Errorf("games = %+v, want cover URLs from the referenced covers", games)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// keyPrefix validates a key prefix taken from the event field name.
+func keyPrefix(name, prefix string) (string, error) {
+	cleaned := path.Clean(prefix)
+	if cleaned != prefix || prefix == "." || strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "..") {
+		return "", fmt.Errorf("Invalid %s %q: must be a relative key prefix", name, prefix)
+	}
+	return prefix, nil
+}
+
+// idempotencyWindow reads IDEMPOTENCY_WINDOW, how long a completed run satisfies repeats of
+// its idempotency key. Zero, the default, means it always does.
+func idempotencyWindow() (time.Duration, error) {
+	v := os.Getenv("IDEMPOTENCY_WINDOW")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid IDEMPOTENCY_WINDOW %q: must be a non-negative duration", v)
+	}
+	return d, nil
+}
+
+// completedRun returns the Result of an earlier complete run under prefix that is still
+// within window, or nil when the run has to go ahead.
+func completedRun(ctx context.Context, logger *log.Entry, prefix string, window time.Duration) *Result {
+	manifest, err := readManifest(ctx, path.Join(prefix, manifestKey))
+	if err != nil || !manifest.Complete {
+		return nil
+	}
+	if window > 0 && time.Since(manifest.StartedAt) > window {
+		logger.Infof("Run %s under %s is older than IDEMPOTENCY_WINDOW, running again", manifest.RunID, prefix)
+		return nil
+	}
+	logger.Infof("Run %s already completed under %s, skipping", manifest.RunID, prefix)
+	return manifestResult(manifest)
+}
+
+// manifestResult rebuilds a Result from a completed run's manifest, with Records keyed by
+// entity like a fresh run's.
+func manifestResult(m *Manifest) *Result {
+	res := &Result{
+		RunID:        m.RunID,
+		Duration:     m.Duration,
+		Records:      maps.Clone(m.EntityRecords),
+		FailedPages:  maps.Clone(m.FailedPages),
+		UploadedKeys: slices.Sorted(maps.Values(m.Keys)),
+		Duplicate:    true,
+	}
+	return res
+}
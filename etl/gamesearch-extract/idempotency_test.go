@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+func TestCompletedRunMatchesFreshResult(t *testing.T) {
+	setOfflineEnv(t)
+	fixtures := t.TempDir()
+	t.Setenv("IGDB_FIXTURE_DIR", fixtures)
+	t.Setenv("SKIP_EMPTY_SUMMARY", "true")
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	for entity, records := range map[string]any{
+		"genres": []igdb.Genre{{ID: 12, Name: "RPG"}},
+		"games":  []igdb.Game{{ID: 1, Summary: "kept"}, {ID: 2}},
+	} {
+		data, _ := json.Marshal(records)
+		if err := os.WriteFile(filepath.Join(fixtures, entity+".json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fresh, err := fetchAndStoreData(ctx, logger, "run", runOptions{Prefix: "nightly"})
+	if err != nil {
+		t.Fatalf("fetchAndStoreData: %v", err)
+	}
+
+	repeat := completedRun(ctx, logger, "nightly", 0)
+	if repeat == nil {
+		t.Fatal("completedRun found no completed run")
+	}
+	if !maps.Equal(repeat.Records, fresh.Records) || !maps.Equal(repeat.FailedPages, fresh.FailedPages) {
+		t.Errorf("repeat records %v, failed pages %v; want the fresh run's %v, %v",
+			repeat.Records, repeat.FailedPages, fresh.Records, fresh.FailedPages)
+	}
+	if repeat.Records["games"] != 2 || repeat.Records["genres"] != 1 {
+		t.Errorf("records = %v, want the 2 games and 1 genre fetched", repeat.Records)
+	}
+}
@@ -0,0 +1,149 @@
+package igdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before expiry a token is proactively refreshed.
+const tokenRefreshMargin = 5 * time.Minute
+
+// CachedToken is an Authorization value persisted between runs by a TokenCache.
+type CachedToken struct {
+	Authorization string    `json:"authorization"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// TokenCache persists the access token between runs so a new process can reuse a token that
+// is still valid instead of re-authenticating. Implementations handle their own failures;
+// a token that can't be loaded just means authenticating again.
+type TokenCache interface {
+	Load() (CachedToken, bool)
+	Store(token CachedToken)
+}
+
+// TokenSource holds the Twitch access token shared by every fetcher in a run. Refreshes are
+// serialized by a mutex so concurrent workers don't all re-authenticate at once.
+type TokenSource struct {
+	client       *http.Client
+	authURL      string
+	clientID     string
+	clientSecret string
+	cache        TokenCache
+
+	mu            sync.Mutex
+	authorization string
+	expiresAt     time.Time
+}
+
+// NewTokenSource returns a TokenSource holding a valid token, taken from cache when it has one
+// that isn't about to expire. An empty authURL means DefaultAuthURL; cache may be nil.
+func NewTokenSource(client *http.Client, authURL, clientID, clientSecret string, cache TokenCache) (*TokenSource, error) {
+	if authURL == "" {
+		authURL = DefaultAuthURL
+	}
+	t := &TokenSource{client: client, authURL: authURL, clientID: clientID, clientSecret: clientSecret, cache: cache}
+	if cache != nil {
+		if token, ok := cache.Load(); ok && time.Until(token.ExpiresAt) >= tokenRefreshMargin {
+			t.authorization = token.Authorization
+			t.expiresAt = token.ExpiresAt
+			return t, nil
+		}
+	}
+	if err := t.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// get returns the current Authorization header value, refreshing the token first if it is
+// about to expire.
+func (t *TokenSource) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Until(t.expiresAt) < tokenRefreshMargin {
+		if err := t.refreshLocked(); err != nil {
+			return "", err
+		}
+	}
+	return t.authorization, nil
+}
+
+// refresh replaces a token IGDB rejected. If another worker already replaced stale, the
+// newer Authorization value is returned without re-authenticating again.
+func (t *TokenSource) refresh(stale string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.authorization != stale {
+		return t.authorization, nil
+	}
+	if err := t.refreshLocked(); err != nil {
+		return "", err
+	}
+	return t.authorization, nil
+}
+
+func (t *TokenSource) refreshLocked() error {
+	authResp, err := RetrieveAuthToken(t.client, t.authURL, t.clientID, t.clientSecret)
+	if err != nil {
+		return err
+	}
+	t.authorization = authorizationHeader(authResp)
+	t.expiresAt = time.Now().Add(time.Duration(authResp.ExpiresIn) * time.Second)
+
+	if t.cache != nil {
+		t.cache.Store(CachedToken{Authorization: t.authorization, ExpiresAt: t.expiresAt})
+	}
+	return nil
+}
+
+// authorizationHeader builds the Authorization value from the token type Twitch returns,
+// which comes back lowercase ("bearer"), defaulting to Bearer if it is missing.
+func authorizationHeader(authResp *AuthTokenResponse) string {
+	tokenType := "Bearer"
+	if authResp.TokenType != "" {
+		tokenType = strings.ToUpper(authResp.TokenType[:1]) + authResp.TokenType[1:]
+	}
+	return tokenType + " " + authResp.AccessToken
+}
+
+// DefaultAuthURL is Twitch's OAuth token endpoint, which issues IGDB access tokens.
+const DefaultAuthURL = "https://id.twitch.tv/oauth2/token"
+
+func RetrieveAuthToken(client *http.Client, authURL, clientID, clientSecret string) (*AuthTokenResponse, error) {
+	authResp := new(AuthTokenResponse)
+	res, err := client.Post(fmt.Sprintf("%s?client_id=%s&client_secret=%s&grant_type=client_credentials", authURL, clientID, clientSecret), "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// Twitch reports failures as {"status": 403, "message": "invalid client"}
+		body, _ := io.ReadAll(res.Body)
+		var twitchErr struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &twitchErr) == nil && twitchErr.Message != "" {
+			message = twitchErr.Message
+		}
+		return nil, fmt.Errorf("Twitch auth failed: %d: %s", res.StatusCode, message)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&authResp); err != nil {
+		return nil, err
+	}
+	if authResp.AccessToken == "" {
+		return nil, fmt.Errorf("Twitch auth failed: response contained no access token")
+	}
+
+	return authResp, nil
+}
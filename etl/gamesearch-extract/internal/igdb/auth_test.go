@@ -0,0 +1,56 @@
+package igdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// twitchTokenResponse is a sample client credentials response from Twitch's token endpoint.
+const twitchTokenResponse = `{"access_token":"jostpf5q0uzmxmkba9iyug38kjtgh","expires_in":5011271,"token_type":"bearer"}`
+
+func TestDecodeAuthTokenResponse(t *testing.T) {
+	var resp AuthTokenResponse
+	if err := json.Unmarshal([]byte(twitchTokenResponse), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := AuthTokenResponse{AccessToken: "jostpf5q0uzmxmkba9iyug38kjtgh", ExpiresIn: 5011271, TokenType: "bearer"}
+	if resp != want {
+		t.Errorf("decoded %+v, want %+v", resp, want)
+	}
+	if got := authorizationHeader(&resp); got != "Bearer jostpf5q0uzmxmkba9iyug38kjtgh" {
+		t.Errorf("authorizationHeader = %q", got)
+	}
+}
+
+func TestAuthorizationHeaderDefaultsToBearer(t *testing.T) {
+	if got := authorizationHeader(&AuthTokenResponse{AccessToken: "abc"}); got != "Bearer abc" {
+		t.Errorf("authorizationHeader = %q, want %q", got, "Bearer abc")
+	}
+}
+
+func TestRetrieveAuthToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("client_id") != "id" || r.URL.Query().Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":400,"message":"invalid client"}`)
+			return
+		}
+		fmt.Fprint(w, twitchTokenResponse)
+	}))
+	defer srv.Close()
+
+	resp, err := RetrieveAuthToken(srv.Client(), srv.URL, "id", "secret")
+	if err != nil {
+		t.Fatalf("RetrieveAuthToken: %v", err)
+	}
+	if resp.TokenType != "bearer" || resp.AccessToken == "" {
+		t.Errorf("got %+v", resp)
+	}
+
+	if _, err := RetrieveAuthToken(srv.Client(), srv.URL, "wrong", "secret"); err == nil {
+		t.Error("RetrieveAuthToken succeeded with a rejected client")
+	}
+}
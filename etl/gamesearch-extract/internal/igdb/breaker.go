@@ -0,0 +1,120 @@
+package igdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for every request made after the circuit breaker has tripped.
+var ErrCircuitOpen = errors.New("IGDB circuit breaker tripped")
+
+const (
+	defaultBreakerWindow = time.Minute
+	// breakerMinRequests keeps a handful of early failures from tripping the breaker on their own
+	breakerMinRequests = 10
+)
+
+// Breaker tracks the outcome of recent request attempts across every worker and trips once
+// the share that failed within the window exceeds the threshold. A tripped breaker stays open
+// for the rest of the run, so an outage fails the run quickly instead of retrying every page.
+// A nil Breaker never trips.
+type Breaker struct {
+	threshold float64
+	window    time.Duration
+
+	mu sync.Mutex
+	// attempts holds the outcomes within the window, oldest first
+	attempts []breakerAttempt
+	tripped  error
+}
+
+type breakerAttempt struct {
+	at     time.Time
+	failed bool
+}
+
+// NewBreaker returns a Breaker that trips when more than thresholdPct percent of the attempts
+// in the last window failed.
+func NewBreaker(thresholdPct float64, window time.Duration) *Breaker {
+	return &Breaker{threshold: thresholdPct, window: window}
+}
+
+// LoadBreaker reads IGDB_BREAKER_THRESHOLD (a percentage) and IGDB_BREAKER_WINDOW (a Go
+// duration, defaulting to 1m). It returns nil, disabling the breaker, when no threshold is set.
+func LoadBreaker() (*Breaker, error) {
+	v := os.Getenv("IGDB_BREAKER_THRESHOLD")
+	if v == "" {
+		return nil, nil
+	}
+	threshold, err := strconv.ParseFloat(v, 64)
+	if err != nil || threshold <= 0 || threshold > 100 {
+		return nil, fmt.Errorf("Invalid IGDB_BREAKER_THRESHOLD %q: must be greater than 0 and at most 100", v)
+	}
+
+	window := defaultBreakerWindow
+	if v := os.Getenv("IGDB_BREAKER_WINDOW"); v != "" {
+		window, err = time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("Invalid IGDB_BREAKER_WINDOW %q: must be a positive duration", v)
+		}
+	}
+	return NewBreaker(threshold, window), nil
+}
+
+// Err returns the reason the breaker tripped, wrapping ErrCircuitOpen, or nil while it's closed.
+func (b *Breaker) Err() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripped
+}
+
+// record counts the outcome of one request attempt. Only transient failures count against
+// the breaker: a 429 is the rate limiter's concern, and a rejected query or an undecodable
+// response isn't a sign of an outage.
+func (b *Breaker) record(logger Logger, err error) {
+	if b == nil {
+		return
+	}
+	var apiErr *APIError
+	if err != nil && (!isRetryable(err) || errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tripped != nil {
+		return
+	}
+
+	now := time.Now()
+	b.attempts = append(b.attempts, breakerAttempt{at: now, failed: err != nil})
+	expired := 0
+	for expired < len(b.attempts) && now.Sub(b.attempts[expired].at) > b.window {
+		expired++
+	}
+	b.attempts = b.attempts[expired:]
+
+	if err == nil || len(b.attempts) < breakerMinRequests {
+		return
+	}
+	failed := 0
+	for _, a := range b.attempts {
+		if a.failed {
+			failed++
+		}
+	}
+	failedPct := float64(failed) / float64(len(b.attempts)) * 100
+	if failedPct > b.threshold {
+		b.tripped = fmt.Errorf("%w: %d of %d requests failed in the last %s (threshold %.1f%%), last error: %v",
+			ErrCircuitOpen, failed, len(b.attempts), b.window, b.threshold, err)
+		logger.Errorf("%v", b.tripped)
+	}
+}
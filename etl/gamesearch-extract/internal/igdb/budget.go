@@ -0,0 +1,38 @@
+package igdb
+
+import "sync/atomic"
+
+// RecordBudget caps the total number of records fetched across every entity in a run.
+// A nil budget is unlimited.
+type RecordBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func NewRecordBudget(limit int) *RecordBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &RecordBudget{limit: int64(limit)}
+}
+
+// take reserves up to n records and returns how many were granted.
+func (b *RecordBudget) take(n int) int {
+	if b == nil {
+		return n
+	}
+	for {
+		used := b.used.Load()
+		granted := min(int64(n), b.limit-used)
+		if granted <= 0 {
+			return 0
+		}
+		if b.used.CompareAndSwap(used, used+granted) {
+			return int(granted)
+		}
+	}
+}
+
+func (b *RecordBudget) exhausted() bool {
+	return b != nil && b.used.Load() >= b.limit
+}
@@ -0,0 +1,124 @@
+package igdb
+
+import (
+	"encoding/json"
+)
+
+// checkpointInterval is how many keyset pages are buffered between checkpoints.
+const checkpointInterval = 20
+
+// Checkpoint records how far a keyset fetch got. Every record with an ID up to LastID has been
+// saved to the CheckpointStore in Chunks chunks.
+type Checkpoint struct {
+	// Query is the query being fetched; a checkpoint for a different query is discarded
+	Query  string `json:"query"`
+	LastID int    `json:"last_id"`
+	Chunks int    `json:"chunks"`
+}
+
+// CheckpointStore persists fetched records so an interrupted fetch can resume where it left
+// off instead of starting over. Checkpoints are keyed by entity, so each entity checkpoints
+// independently.
+type CheckpointStore interface {
+	// Load returns the entity's checkpoint and its chunks in order, or nil if there is none.
+	Load(entity string) (*Checkpoint, [][]byte, error)
+	// Save stores chunk, a JSON array of records, as chunk number cp.Chunks-1 and then cp.
+	Save(entity string, cp Checkpoint, chunk []byte) error
+	// Clear removes the entity's checkpoint once its fetch has completed.
+	Clear(entity string) error
+}
+
+// checkpointer buffers the pages of a keyset fetch and saves them to the store every
+// checkpointInterval pages. A nil checkpointer does nothing.
+type checkpointer[T Entity] struct {
+	store  CheckpointStore
+	entity string
+	logger Logger
+	cp     Checkpoint
+	buf    []T
+	pages  int
+}
+
+// resume loads the checkpoint for query, returning the records already fetched and the ID to
+// continue after. A checkpoint for another query is cleared and the fetch starts from zero.
+func (c *checkpointer[T]) resume(query string) ([]T, int) {
+	if c == nil {
+		return nil, 0
+	}
+	c.cp = Checkpoint{Query: query}
+
+	cp, chunks, err := c.store.Load(c.entity)
+	if err != nil {
+		c.logger.Warnf("Error loading %s checkpoint, starting from the beginning: %v", c.entity, err)
+		return nil, 0
+	}
+	if cp == nil {
+		return nil, 0
+	}
+	if cp.Query != query {
+		c.logger.Warnf("Discarding %s checkpoint for a different query", c.entity)
+		c.clear()
+		return nil, 0
+	}
+
+	var records []T
+	for i, chunk := range chunks {
+		var page []T
+		if err := json.Unmarshal(chunk, &page); err != nil {
+			c.logger.Warnf("Error decoding %s checkpoint chunk %d, starting from the beginning: %v", c.entity, i, err)
+			c.clear()
+			return nil, 0
+		}
+		records = append(records, page...)
+	}
+
+	c.cp = *cp
+	c.logger.Infof("Resuming %s from checkpoint after ID %d (%d records)", c.entity, cp.LastID, len(records))
+	return records, cp.LastID
+}
+
+// add buffers a page, saving a checkpoint once enough pages have accumulated.
+func (c *checkpointer[T]) add(page []T) {
+	if c == nil {
+		return
+	}
+	c.buf = append(c.buf, page...)
+	c.pages++
+	if c.pages >= checkpointInterval {
+		c.flush()
+	}
+}
+
+// flush saves the buffered records. A failed save is logged and the records stay buffered
+// for the next attempt, since losing a checkpoint only costs a longer resume.
+func (c *checkpointer[T]) flush() {
+	if c == nil || len(c.buf) == 0 {
+		return
+	}
+
+	chunk, err := json.Marshal(c.buf)
+	if err != nil {
+		c.logger.Warnf("Error marshaling %s checkpoint: %v", c.entity, err)
+		return
+	}
+	cp := c.cp
+	cp.LastID = c.buf[len(c.buf)-1].GetID()
+	cp.Chunks++
+	if err := c.store.Save(c.entity, cp, chunk); err != nil {
+		c.logger.Warnf("Error saving %s checkpoint: %v", c.entity, err)
+		return
+	}
+
+	c.cp = cp
+	c.buf = nil
+	c.pages = 0
+}
+
+func (c *checkpointer[T]) clear() {
+	if c == nil {
+		return
+	}
+	if err := c.store.Clear(c.entity); err != nil {
+		c.logger.Warnf("Error clearing %s checkpoint: %v", c.entity, err)
+	}
+}
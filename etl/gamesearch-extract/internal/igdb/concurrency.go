@@ -0,0 +1,111 @@
+package igdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ConcurrencyModel selects how a Fetcher spreads page requests across goroutines. Both models
+// share the Fetcher's rate limiter, so switching between them doesn't change request pacing.
+type ConcurrencyModel string
+
+const (
+	// ConcurrencyPool is the worker pool where each worker walks its own offset stride.
+	ConcurrencyPool ConcurrencyModel = "pool"
+	// ConcurrencyErrgroup dispatches one task per page in offset order, bounded by errgroup.SetLimit.
+	ConcurrencyErrgroup ConcurrencyModel = "errgroup"
+)
+
+func ParseConcurrencyModel(value string) (ConcurrencyModel, error) {
+	switch model := ConcurrencyModel(value); model {
+	case "":
+		return ConcurrencyPool, nil
+	case ConcurrencyPool, ConcurrencyErrgroup:
+		return model, nil
+	}
+	return "", fmt.Errorf("invalid FETCH_CONCURRENCY %q, expected pool or errgroup", value)
+}
+
+// streamErrgroup is the errgroup counterpart to the worker pool in Stream. Pages are dispatched
+// in offset order until one comes back partial, or until maxConsecutivePageFailures pages in a
+// row have failed, at which point dispatch stops and the in-flight pages are allowed to finish.
+// Failed pages, and the offsets left undispatched after a run of failures, then get the same
+// retry pass as the pool.
+func (f *Fetcher[T]) streamErrgroup(ctx context.Context, query string, numWorkers, pageLimit int) <-chan []T {
+	resultChan := make(chan []T)
+	timings := newLatencyHistogram()
+
+	go func() {
+		defer close(resultChan)
+		defer timings.log(f.client.Logger, f.Entity())
+
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(max(1, min(numWorkers, MaxWorkers)))
+
+		var done, stopped atomic.Bool
+		var failures atomic.Int32
+		// next is declared outside the loop so it's left at the first offset not dispatched
+		next := f.OffsetStart
+		for ; f.inRange(next) && !done.Load() && !stopped.Load() && gctx.Err() == nil; next += pageLimit {
+			offset := next
+			g.Go(func() error {
+				if done.Load() {
+					return nil
+				}
+				if err := f.client.Limiter.Wait(gctx); err != nil {
+					return err
+				}
+
+				res, returned, err := f.fetchPage(query, pageLimit, offset, timings)
+				if gctx.Err() != nil {
+					return gctx.Err()
+				}
+				if err != nil {
+					f.client.Logger.Errorf("Error fetching results with offset %d: %v\n", offset, err)
+					f.pages.fail(offset, err)
+					if n := failures.Add(1); n >= maxConsecutivePageFailures && !stopped.Swap(true) {
+						f.client.Logger.Errorf("Stopping dispatch after %d consecutive failed pages", n)
+					}
+					return nil
+				}
+				failures.Store(0)
+				f.pages.success()
+				if returned < pageLimit {
+					done.Store(true)
+				}
+
+				select {
+				case resultChan <- res:
+				case <-gctx.Done():
+					return gctx.Err()
+				}
+
+				f.client.Logger.Infof("Queried results at offset %d\n", offset)
+				return nil
+			})
+		}
+
+		err := g.Wait()
+		switch {
+		case ctx.Err() != nil:
+			// Cancelled by the caller, e.g. once MAX_RECORDS was reached
+			return
+		case err != nil:
+			// Only the rate limiter fails the group, and the pages it stopped are unaccounted for
+			f.client.Logger.Errorf("Error waiting for the rate limiter, stopping the %s fetch: %v", f.Entity(), err)
+			f.pages.markIncomplete()
+			return
+		}
+		f.client.Logger.Infof("All workers finished.")
+
+		if stopped.Load() && !done.Load() && f.inRange(next) {
+			f.pages.abandon(next)
+		}
+		f.retryFailed(ctx, query, pageLimit, pageLimit, timings, resultChan)
+	}()
+
+	return resultChan
+}
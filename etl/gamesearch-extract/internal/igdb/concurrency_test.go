@@ -0,0 +1,96 @@
+package igdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// errorLogger is a Logger that keeps what's logged at error level.
+type errorLogger struct {
+	discardLogger
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *errorLogger) Errorf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func newErrgroupFetcher(t *testing.T, srv *fakeIGDB) *Fetcher[Genre] {
+	client := newTestClient(t, srv)
+	client.Concurrency = ConcurrencyErrgroup
+	return newGenresFetcher(client)
+}
+
+func TestErrgroupRetriesFailedPages(t *testing.T) {
+	srv := &fakeIGDB{total: 95, fail: func(page string, attempt int) bool {
+		return attempt == 1 && (page == "offset-20" || page == "offset-60")
+	}}
+	f := newErrgroupFetcher(t, srv)
+
+	genres, err := f.FetchAll("fields id, name;", 4, 10)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, genres, 95)
+}
+
+func TestErrgroupResumesAfterFailureRun(t *testing.T) {
+	// With one worker the three failures are consecutive, so dispatch stops at offset 60 and
+	// the retry pass has to fetch the failed pages and everything after them
+	srv := &fakeIGDB{total: 195, fail: func(page string, attempt int) bool {
+		offset := offsetOf(page)
+		return attempt == 1 && offset >= 30 && offset <= 50
+	}}
+	f := newErrgroupFetcher(t, srv)
+
+	genres, err := f.FetchAll("fields id, name;", 1, 10)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, genres, 195)
+}
+
+func TestErrgroupReportsIncompleteFetch(t *testing.T) {
+	// Everything from offset 30 on keeps failing, including where the retry pass resumes
+	srv := &fakeIGDB{total: 195, fail: func(page string, attempt int) bool {
+		return offsetOf(page) >= 30
+	}}
+	f := newErrgroupFetcher(t, srv)
+
+	genres, err := f.FetchAll("fields id, name;", 1, 10)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("FetchAll error = %v, want a *FetchError", err)
+	}
+	if !fetchErr.Incomplete {
+		t.Errorf("FetchError.Incomplete = false, want true")
+	}
+	if len(genres) != 30 {
+		t.Errorf("got %d genres, want the 30 before the failures", len(genres))
+	}
+}
+
+func TestErrgroupCapLogsNoError(t *testing.T) {
+	logger := &errorLogger{}
+	client := newInProcessClient(&fakeIGDB{total: 5000})
+	client.Concurrency = ConcurrencyErrgroup
+	client.MaxRecords = 137
+	client.Logger = logger
+	f := newGenresFetcher(client)
+
+	genres, err := f.FetchAll("fields id, name;", 8, 10)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	if len(genres) != 137 {
+		t.Errorf("got %d genres, want 137", len(genres))
+	}
+	if len(logger.errors) > 0 {
+		t.Errorf("stopping at MAX_RECORDS logged errors: %v", logger.errors)
+	}
+}
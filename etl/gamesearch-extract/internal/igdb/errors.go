@@ -0,0 +1,208 @@
+package igdb
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAuth        = errors.New("IGDB authentication failed")
+	ErrRateLimited = errors.New("IGDB rate limit exceeded")
+	ErrBadQuery    = errors.New("IGDB rejected the query")
+)
+
+// Response headers that may carry the identifier IGDB support asks for, in order of preference.
+var requestIDHeaders = []string{"X-Request-Id", "X-Amzn-Requestid", "Cf-Ray"}
+
+func requestID(h http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := h.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// APIError is returned when IGDB responds with a non-200 status.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RequestID  string
+	// RetryAfter is the wait requested by a Retry-After header, or zero if none was sent.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("API returned status code %d (request ID %s): %s", e.StatusCode, e.RequestID, e.Body)
+	}
+	return fmt.Sprintf("API returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Unwrap maps the status code onto its sentinel error so callers can use errors.Is.
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadRequest:
+		return ErrBadQuery
+	}
+	return nil
+}
+
+// DecodeError is returned when an IGDB response body can't be decoded.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Error decoding API response: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// FetchError reports the pages that failed while fetching an entity. The partial results
+// fetched alongside it are still returned, so callers can decide whether they're acceptable.
+type FetchError struct {
+	Entity string
+	Pages  int
+	Failed int
+	// Offsets lists where each failed page started: its offset, or the ID a keyset page followed
+	Offsets []int
+	// Incomplete is set when a failure ended a walk through the pages early, so an unknown
+	// number of records after the failed pages were never requested
+	Incomplete bool
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	msg := fmt.Sprintf("%s: %d of %d pages failed (%d succeeded) at offsets %v", e.Entity, e.Failed, e.Pages, e.Pages-e.Failed, e.Offsets)
+	if e.Incomplete {
+		msg += ", fetch stopped before the last page"
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// pageErrors collects per-page outcomes of a fetch. The zero value is ready to use.
+type pageErrors struct {
+	mu        sync.Mutex
+	succeeded int
+	// failures maps the offset of each failed page to its latest error
+	failures map[int]error
+	// abandoned holds the next offset of each worker stride given up after repeated failures
+	abandoned []int
+	// incomplete is set once pages after a failure were left unfetched for good
+	incomplete bool
+}
+
+func (p *pageErrors) success() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.succeeded++
+}
+
+func (p *pageErrors) fail(offset int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures == nil {
+		p.failures = make(map[int]error)
+	}
+	p.failures[offset] = err
+}
+
+// recovered turns the failure at offset into a success after a retry fetched the page.
+func (p *pageErrors) recovered(offset int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.failures, offset)
+	p.succeeded++
+}
+
+// abandon records that a worker gave up on its stride before reaching offset.
+func (p *pageErrors) abandon(offset int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.abandoned = append(p.abandoned, offset)
+}
+
+// takeAbandoned returns the offsets recorded by abandon in ascending order and forgets them.
+func (p *pageErrors) takeAbandoned() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	offsets := p.abandoned
+	p.abandoned = nil
+	slices.Sort(offsets)
+	return offsets
+}
+
+// markIncomplete records that the fetch stopped before its last page.
+func (p *pageErrors) markIncomplete() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.incomplete = true
+}
+
+func (p *pageErrors) failed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.failures)
+}
+
+// failedOffsets returns the offsets of the failed pages in ascending order.
+func (p *pageErrors) failedOffsets() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Sorted(maps.Keys(p.failures))
+}
+
+// err aggregates the page failures into a *FetchError, or returns nil if every page succeeded.
+func (p *pageErrors) err(entity string) error {
+	offsets := p.failedOffsets()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(offsets) == 0 && !p.incomplete {
+		return nil
+	}
+	errs := make([]error, len(offsets))
+	for i, offset := range offsets {
+		errs[i] = fmt.Errorf("offset %d: %w", offset, p.failures[offset])
+	}
+	return &FetchError{
+		Entity:     entity,
+		Pages:      p.succeeded + len(offsets),
+		Failed:     len(offsets),
+		Offsets:    offsets,
+		Incomplete: p.incomplete,
+		Err:        errors.Join(errs...),
+	}
+}
@@ -0,0 +1,150 @@
+package igdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	limitPattern  = regexp.MustCompile(`limit (\d+);`)
+	offsetPattern = regexp.MustCompile(`offset (\d+);`)
+	afterPattern  = regexp.MustCompile(`id > (\d+)`)
+)
+
+// fakeIGDB serves an endpoint holding genres with IDs 1 to total. Offset queries page by
+// position and keyset queries by ID, like IGDB does.
+type fakeIGDB struct {
+	total int
+	// fail, when set, decides whether the attempt-th request (from 1) for a page fails with a
+	// 500. Pages are named "offset-<n>" or "after-<id>".
+	fail func(page string, attempt int) bool
+
+	mu       sync.Mutex
+	attempts map[string]int
+	requests int
+}
+
+func (s *fakeIGDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	query := string(body)
+
+	limit := 10
+	if m := limitPattern.FindStringSubmatch(query); m != nil {
+		limit, _ = strconv.Atoi(m[1])
+	}
+	var page string
+	start := 0
+	if m := afterPattern.FindStringSubmatch(query); m != nil {
+		after, _ := strconv.Atoi(m[1])
+		page, start = "after-"+m[1], after
+	} else if m := offsetPattern.FindStringSubmatch(query); m != nil {
+		page = "offset-" + m[1]
+		start, _ = strconv.Atoi(m[1])
+	}
+
+	s.mu.Lock()
+	s.requests++
+	if s.attempts == nil {
+		s.attempts = make(map[string]int)
+	}
+	s.attempts[page]++
+	attempt := s.attempts[page]
+	s.mu.Unlock()
+
+	if s.fail != nil && s.fail(page, attempt) {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(s.records(start, limit))
+}
+
+// records returns up to limit genres after the first start.
+func (s *fakeIGDB) records(start, limit int) []Genre {
+	records := []Genre{}
+	for id := start + 1; id <= min(start+limit, s.total); id++ {
+		records = append(records, Genre{ID: id, Name: fmt.Sprintf("genre %d", id)})
+	}
+	return records
+}
+
+// discardLogger drops everything logged by the fetch code.
+type discardLogger struct{}
+
+func (discardLogger) Debugf(string, ...any) {}
+func (discardLogger) Infof(string, ...any)  {}
+func (discardLogger) Warnf(string, ...any)  {}
+func (discardLogger) Errorf(string, ...any) {}
+
+// newTestClient returns a Client pointed at an httptest server running handler, with a static
+// token, no rate limit and no request retries, so injected failures reach the page logic.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return &Client{
+		HTTP:     srv.Client(),
+		BaseURL:  srv.URL,
+		ClientID: "test",
+		Tokens:   &TokenSource{authorization: "Bearer test", expiresAt: time.Now().Add(time.Hour)},
+		Limiter:  NewBudgetLimiter(rate.Inf, 1),
+		Retry:    &RetryPolicy{maxRetries: 0, baseDelay: time.Millisecond},
+		Logger:   discardLogger{},
+	}
+}
+
+// assertAllGenres checks that genres holds every ID from 1 to total exactly once.
+func assertAllGenres(t *testing.T, genres []Genre, total int) {
+	t.Helper()
+	if len(genres) != total {
+		t.Fatalf("got %d genres, want %d", len(genres), total)
+	}
+	seen := make(map[int]bool, total)
+	for _, g := range genres {
+		if g.ID < 1 || g.ID > total || seen[g.ID] {
+			t.Fatalf("unexpected or duplicate genre ID %d", g.ID)
+		}
+		seen[g.ID] = true
+	}
+}
+
+// handlerTransport serves requests by calling a handler in-process, so a test can count its
+// goroutines without a server's connection goroutines in the way.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+	return rec.Result(), nil
+}
+
+// newInProcessClient is newTestClient without a network server.
+func newInProcessClient(handler http.Handler) *Client {
+	return &Client{
+		HTTP:     &http.Client{Transport: handlerTransport{handler}},
+		BaseURL:  "http://igdb.test",
+		ClientID: "test",
+		Tokens:   &TokenSource{authorization: "Bearer test", expiresAt: time.Now().Add(time.Hour)},
+		Limiter:  NewBudgetLimiter(rate.Inf, 1),
+		Retry:    &RetryPolicy{maxRetries: 0, baseDelay: time.Millisecond},
+		Logger:   discardLogger{},
+	}
+}
+
+func newGenresFetcher(client *Client) *Fetcher[Genre] {
+	return NewFetcher[Genre](context.Background(), client, "genres")
+}
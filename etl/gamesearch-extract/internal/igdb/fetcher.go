@@ -0,0 +1,655 @@
+// Package igdb contains the IGDB record types and the paginated, rate-limited fetch logic
+// shared by the gamesearch binaries.
+package igdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger is the logging interface the fetch code writes to. *logrus.Logger and *logrus.Entry
+// both satisfy it.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Recorder receives the outcome of each entity fetch and of each request made for it, e.g.
+// for a run summary or metrics.
+type Recorder interface {
+	RecordFetch(entity string, records, failedPages int, truncated bool, elapsed time.Duration, err error)
+	RecordRequest(entity string, elapsed time.Duration, err error)
+}
+
+// Client holds the state shared by every Fetcher in a run: credentials, the HTTP client,
+// the rate limiter and the run-wide record budget.
+type Client struct {
+	HTTP *http.Client
+	// BaseURL is the API root endpoints are resolved against; empty means DefaultBaseURL
+	BaseURL  string
+	ClientID string
+	Tokens   *TokenSource
+	Limiter  *BudgetLimiter
+	// Budget caps records across every entity; nil is unlimited
+	Budget *RecordBudget
+	// MaxRecords caps the records fetched for each entity; zero is unlimited
+	MaxRecords  int
+	Concurrency ConcurrencyModel
+	// Retry defaults to defaultRetryPolicy when nil
+	Retry *RetryPolicy
+	// Breaker, when set, fails every request once recent attempts have mostly failed
+	Breaker *Breaker
+	// RequestTimeout bounds each request attempt; zero means DefaultRequestTimeout
+	RequestTimeout time.Duration
+	// Recorder is optional
+	Recorder Recorder
+	// Checkpoints, when set, lets keyset fetches resume after an interrupted run
+	Checkpoints CheckpointStore
+	// LenientDecode skips records that fail to decode instead of failing their whole page
+	LenientDecode bool
+	// DropUnknownFields retries a query without a field IGDB rejected as unknown, instead of
+	// failing the page
+	DropUnknownFields bool
+	// RawResponses, when set, receives every page's response body before it is decoded
+	RawResponses RawStore
+	Logger       Logger
+}
+
+// PageFetcher fetches every record of an entity matching a query. Fetcher is the live
+// implementation; callers that depend on PageFetcher can substitute fakes or fixtures.
+type PageFetcher[T Entity] interface {
+	FetchAll(query string, numWorkers, pageLimit int) ([]T, error)
+}
+
+var _ PageFetcher[Game] = (*Fetcher[Game])(nil)
+
+type Fetcher[T Entity] struct {
+	// Pagination defaults to PaginationOffset
+	Pagination Pagination
+	// OffsetStart and OffsetEnd restrict offset pagination to the records in
+	// [OffsetStart, OffsetEnd); an OffsetEnd of 0 leaves the range open-ended
+	OffsetStart, OffsetEnd int
+	// OnPage, when set, is passed each page FetchAll receives, as it arrives, so downstream
+	// work can start before the fetch finishes. It must not block for long or modify the page.
+	OnPage func(page []T)
+
+	client *Client
+	url    string
+	// startID is the ID keyset pagination starts after, set when resuming from a checkpoint
+	startID int
+	ctx     context.Context
+
+	pages   pageErrors
+	dropped droppedFields
+}
+
+// DefaultBaseURL is the root of IGDB's v4 API.
+const DefaultBaseURL = "https://api.igdb.com/v4"
+
+// NewFetcher returns a Fetcher for endpoint, e.g. "games", under the client's base URL.
+// Requests stop once ctx is done.
+func NewFetcher[T Entity](ctx context.Context, client *Client, endpoint string) *Fetcher[T] {
+	return &Fetcher[T]{client: client, url: client.endpointURL(endpoint), ctx: ctx}
+}
+
+func (c *Client) endpointURL(endpoint string) string {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + endpoint
+}
+
+// Entity returns the IGDB endpoint name, e.g. "games", for logging.
+func (f *Fetcher[T]) Entity() string {
+	return path.Base(f.url)
+}
+
+func (f *Fetcher[T]) record(records int, truncated bool, elapsed time.Duration, err error) {
+	if f.client.Recorder != nil {
+		f.client.Recorder.RecordFetch(f.Entity(), records, f.pages.failed(), truncated, elapsed, err)
+	}
+}
+
+// FetchQuery runs query, retrying transient failures with exponential backoff until the
+// retry policy is exhausted or the Fetcher's context is cancelled. The last error is returned.
+func (f *Fetcher[T]) FetchQuery(query string) ([]T, error) {
+	results, _, err := f.fetchQuery(query, "")
+	return results, err
+}
+
+// fetchQuery is FetchQuery for the page identified by page, which names the raw response
+// when RawResponses is set. It also returns how many records IGDB sent. That only differs
+// from len(results) when LenientDecode skipped malformed records, and is what tells a full
+// page from the last one.
+func (f *Fetcher[T]) fetchQuery(query, page string) ([]T, int, error) {
+	start := time.Now()
+	var results []T
+	returned := 0
+	var err error
+	for {
+		q := f.dropped.apply(query)
+		err = f.withRetry(func(authorization string) error {
+			var body json.RawMessage
+			if err := f.post(f.url, q, authorization, &body); err != nil {
+				return err
+			}
+			f.saveRaw(page, body)
+
+			var err error
+			results, returned, err = f.decodePage(body)
+			return err
+		})
+		if !f.client.DropUnknownFields {
+			break
+		}
+		field, ok := unknownField(err, q)
+		if !ok {
+			break
+		}
+		// Every later page of the fetch leaves the field out as well
+		f.client.Logger.Warnf("IGDB rejected the %s field %q, retrying without it: %v", f.Entity(), field, err)
+		f.dropped.add(field)
+	}
+	if f.client.Recorder != nil {
+		f.client.Recorder.RecordRequest(f.Entity(), time.Since(start), err)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, returned, nil
+}
+
+// Count returns how many records match query's where clause, using the endpoint's /count route.
+func (f *Fetcher[T]) Count(query string) (int, error) {
+	if err := f.client.Limiter.Wait(f.ctx); err != nil {
+		return 0, err
+	}
+
+	var resp struct {
+		Count int `json:"count"`
+	}
+	err := f.withRetry(func(authorization string) error {
+		return f.post(f.url+"/count", query, authorization, &resp)
+	})
+	return resp.Count, err
+}
+
+// withRetry calls do with the current Authorization value, re-authenticating once if IGDB
+// rejects the token and retrying transient failures with backoff.
+func (c *Client) withRetry(ctx context.Context, entity string, do func(authorization string) error) error {
+	policy := defaultRetryPolicy
+	if c.Retry != nil {
+		policy = *c.Retry
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		if err := c.Breaker.Err(); err != nil {
+			return err
+		}
+		authorization, err := c.Tokens.get()
+		if err != nil {
+			return fmt.Errorf("Error retrieving authentication token: %w", err)
+		}
+
+		err = do(authorization)
+		if errors.Is(err, ErrAuth) && !refreshed {
+			// The token may have been revoked or expired early, so re-authenticate once
+			c.Logger.Warnf("IGDB rejected the access token, refreshing: %v", err)
+			if _, err := c.Tokens.refresh(authorization); err != nil {
+				return fmt.Errorf("Error refreshing authentication token: %w", err)
+			}
+			refreshed = true
+			attempt--
+			continue
+		}
+		if ctx.Err() == nil {
+			c.Breaker.record(c.Logger, err)
+		}
+		var apiErr *APIError
+		rateLimited := errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+		switch {
+		case err == nil:
+			c.Limiter.succeeded(c.Logger)
+		case rateLimited:
+			c.Limiter.rateLimited(c.Logger)
+		}
+		if err == nil || ctx.Err() != nil || attempt >= policy.maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		if rateLimited {
+			// Honor IGDB's requested wait and hold back every worker sharing the limiter
+			delay := apiErr.RetryAfter
+			if delay == 0 {
+				delay = defaultRateLimitCooldown
+			}
+			c.Limiter.pause(delay)
+			c.Logger.Warnf("Retrying %s request in %s (attempt %d of %d): %v", entity, delay, attempt+1, policy.maxRetries, err)
+		} else {
+			delay := policy.backoff(attempt)
+			c.Logger.Warnf("Retrying %s request in %s (attempt %d of %d): %v", entity, delay, attempt+1, policy.maxRetries, err)
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+		}
+		// Retries take their turn at the limiter like any other request, so they can't burst
+		// out together with the workers a pause just released
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// post sends query to url and decodes the JSON response into out.
+func (c *Client) post(ctx context.Context, url, query, authorization string, out any) error {
+	timeout := c.RequestTimeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+	// A per-request deadline turns a stalled IGDB response into an error instead of a hung worker
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewBuffer([]byte(query)))
+	if err != nil {
+		return fmt.Errorf("Error building request: %w", err)
+	}
+
+	req.Header.Set("Client-ID", c.ClientID)
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		if reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return fmt.Errorf("Request timed out after %s: %w", timeout, err)
+		}
+		return fmt.Errorf("Error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	c.Limiter.observe(resp.Header, c.Logger)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RequestID:  requestID(resp.Header),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &DecodeError{Err: err}
+	}
+
+	return nil
+}
+
+func (f *Fetcher[T]) withRetry(do func(authorization string) error) error {
+	return f.client.withRetry(f.ctx, f.Entity(), do)
+}
+
+func (f *Fetcher[T]) post(url, query, authorization string, out any) error {
+	return f.client.post(f.ctx, url, query, authorization, out)
+}
+
+// inRange reports whether offset is before OffsetEnd.
+func (f *Fetcher[T]) inRange(offset int) bool {
+	return f.OffsetEnd == 0 || offset < f.OffsetEnd
+}
+
+// fetchPage fetches the page at offset, shortened so it doesn't run past OffsetEnd, and
+// returns its records along with how many IGDB sent.
+func (f *Fetcher[T]) fetchPage(query string, pageLimit, offset int, timings *latencyHistogram) ([]T, int, error) {
+	if f.OffsetEnd > 0 {
+		pageLimit = min(pageLimit, f.OffsetEnd-offset)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(query)
+	builder.WriteString(fmt.Sprintf("\nlimit %d;\noffset %d;", pageLimit, offset))
+	f.client.Logger.Debugf("Querying %s at offset %d: %q", f.Entity(), offset, builder.String())
+
+	start := time.Now()
+	res, returned, err := f.fetchQuery(builder.String(), strconv.Itoa(offset))
+	timings.observe(time.Since(start))
+	return res, returned, err
+}
+
+func (f *Fetcher[T]) fetchKeysetPage(query string, lastID, pageLimit int, timings *latencyHistogram) ([]T, int, error) {
+	query = keysetQuery(query, lastID, pageLimit)
+	f.client.Logger.Debugf("Querying %s after ID %d: %q", f.Entity(), lastID, query)
+
+	start := time.Now()
+	res, returned, err := f.fetchQuery(query, fmt.Sprintf("after-%d", lastID))
+	timings.observe(time.Since(start))
+	return res, returned, err
+}
+
+// MaxWorkers caps the worker pool; IGDB's rate limit makes more workers than this pointless.
+const MaxWorkers = 32
+
+// MaxPageLimit is the largest limit IGDB accepts for a single page.
+const MaxPageLimit = 500
+
+// maxConsecutivePageFailures is how many pages in a row a pool worker may fail before it gives
+// up on the rest of its stride, so an outage can't keep it walking offsets indefinitely.
+const maxConsecutivePageFailures = 3
+
+// Stream runs the worker pool and sends each page of results on the returned channel as soon as
+// it arrives, so consumers can start processing before the whole catalog has been fetched.
+// The channel is closed once every worker has finished. Cancelling ctx stops the workers, so a
+// consumer that returns early must cancel it to avoid leaving workers blocked on a send.
+//
+// The pool keeps these invariants:
+//   - Worker i owns the offsets OffsetStart + i*pageLimit + k*numWorkers*pageLimit and walks
+//     them itself, so there is no shared offset queue to fill up or drain, and a failed page
+//     never strands another worker waiting for work.
+//   - A worker only blocks in Limiter.Wait, the HTTP request (bounded by the request timeout) or
+//     the send on the result channel, and the first and last also return when ctx is done.
+//   - A worker exits after a partial page, after maxConsecutivePageFailures failed pages in a
+//     row, once its next offset is past OffsetEnd, or when ctx is cancelled. A worker that gives
+//     up after failures records where its stride stopped.
+//   - Once every worker has exited, failed pages are retried once and abandoned strides are
+//     walked to their end. A stride that fails again marks the fetch incomplete. The result
+//     channel is closed exactly once, after the retries.
+func (f *Fetcher[T]) Stream(ctx context.Context, query string, numWorkers, pageLimit int) <-chan []T {
+	if f.Pagination == PaginationKeyset {
+		return f.streamKeyset(ctx, query, pageLimit)
+	}
+	if f.client.Concurrency == ConcurrencyErrgroup {
+		return f.streamErrgroup(ctx, query, numWorkers, pageLimit)
+	}
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > MaxWorkers {
+		f.client.Logger.Warnf("Requested %d workers exceeds the maximum of %d, capping", numWorkers, MaxWorkers)
+		numWorkers = MaxWorkers
+	}
+
+	var wg sync.WaitGroup
+	timings := newLatencyHistogram()
+	resultChan := make(chan []T)
+	stride := pageLimit * numWorkers
+
+	for i := range numWorkers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			failures := 0
+			for offset := f.OffsetStart + pageLimit*i; f.inRange(offset); offset += stride {
+				if err := f.client.Limiter.Wait(ctx); err != nil {
+					if ctx.Err() == nil {
+						f.client.Logger.Errorf("Error rate limiting requests: %v", err)
+					}
+					return
+				}
+
+				res, returned, err := f.fetchPage(query, pageLimit, offset, timings)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					f.client.Logger.Errorf("Error fetching results with offset %d: %v\n", offset, err)
+					f.pages.fail(offset, err)
+					failures++
+					if failures >= maxConsecutivePageFailures {
+						f.client.Logger.Errorf("Worker %d stopping after %d consecutive failed pages", i, failures)
+						if next := offset + stride; f.inRange(next) {
+							f.pages.abandon(next)
+						}
+						return
+					}
+					continue
+				}
+				failures = 0
+				f.pages.success()
+
+				select {
+				case resultChan <- res:
+				case <-ctx.Done():
+					return
+				}
+
+				f.client.Logger.Infof("Queried results at offset %d, worker %d, at time %s\n", offset, i, time.Now().String())
+
+				if returned < pageLimit {
+					f.client.Logger.Infof("Worker %d finished - received partial results (%d < %d)\n", i, returned, pageLimit)
+					return
+				}
+			}
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		f.client.Logger.Infof("All workers finished.")
+		f.retryFailed(ctx, query, pageLimit, stride, timings, resultChan)
+		timings.log(f.client.Logger, f.Entity())
+		close(resultChan)
+	}()
+
+	return resultChan
+}
+
+// retryFailed makes one more attempt at every page that failed in the worker pool's first
+// pass, then walks the rest of every stride a worker abandoned. It runs after the workers have
+// finished, so the retries don't compete with them for the rate limit. Pages that fail again
+// stay recorded as failed.
+func (f *Fetcher[T]) retryFailed(ctx context.Context, query string, pageLimit, stride int, timings *latencyHistogram, resultChan chan<- []T) {
+	offsets := f.pages.failedOffsets()
+	if len(offsets) > 0 {
+		f.client.Logger.Infof("Retrying %d failed %s pages at offsets %v", len(offsets), f.Entity(), offsets)
+	}
+
+	for _, offset := range offsets {
+		if err := f.client.Limiter.Wait(ctx); err != nil {
+			return
+		}
+
+		res, _, err := f.fetchPage(query, pageLimit, offset, timings)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			f.client.Logger.Errorf("Page at offset %d failed again: %v", offset, err)
+			f.pages.fail(offset, err)
+			continue
+		}
+		f.pages.recovered(offset)
+
+		select {
+		case resultChan <- res:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	for _, start := range f.pages.takeAbandoned() {
+		if !f.resumeStride(ctx, query, pageLimit, stride, start, timings, resultChan) {
+			return
+		}
+	}
+}
+
+// resumeStride walks an abandoned stride from start until a partial page. A page that fails
+// again ends the walk and marks the fetch incomplete, since the rest of the stride is unknown.
+// It returns false if ctx was cancelled.
+func (f *Fetcher[T]) resumeStride(ctx context.Context, query string, pageLimit, stride, start int, timings *latencyHistogram, resultChan chan<- []T) bool {
+	f.client.Logger.Infof("Resuming abandoned %s stride at offset %d", f.Entity(), start)
+	for offset := start; f.inRange(offset); offset += stride {
+		if err := f.client.Limiter.Wait(ctx); err != nil {
+			return false
+		}
+
+		res, returned, err := f.fetchPage(query, pageLimit, offset, timings)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			f.client.Logger.Errorf("Page at offset %d failed again, leaving the rest of its stride unfetched: %v", offset, err)
+			f.pages.fail(offset, err)
+			f.pages.markIncomplete()
+			return true
+		}
+		f.pages.success()
+
+		select {
+		case resultChan <- res:
+		case <-ctx.Done():
+			return false
+		}
+
+		if returned < pageLimit {
+			return true
+		}
+	}
+	return true
+}
+
+// FetchEach fetches every page of query and passes each page to handle as it arrives,
+// returning the number of records handled. An error from handle stops the fetch and is
+// returned; otherwise page failures are reported as a *FetchError. If the Fetcher's context is
+// cancelled, the workers stop and the context error is returned.
+func (f *Fetcher[T]) FetchEach(query string, numWorkers, pageLimit int, handle func([]T) error) (int, error) {
+	ctx, cancel := context.WithCancel(f.ctx)
+	defer cancel()
+
+	budget := f.client.Budget
+	if budget.exhausted() {
+		f.client.Logger.Warnf("Run record budget exhausted, skipping %s", f.Entity())
+		f.record(0, true, 0, nil)
+		return 0, nil
+	}
+
+	start := time.Now()
+	truncated := false
+	count := 0
+
+	var cp *checkpointer[T]
+	if f.client.Checkpoints != nil && f.Pagination == PaginationKeyset {
+		cp = &checkpointer[T]{store: f.client.Checkpoints, entity: f.Entity(), logger: f.client.Logger}
+	}
+	// Records saved by an interrupted run are handled first, then the fetch picks up after them
+	resumed, lastID := cp.resume(query)
+	f.startID = lastID
+	if len(resumed) > 0 {
+		page := f.capPage(resumed, count)
+		if err := handle(page); err != nil {
+			f.record(count, false, time.Since(start), err)
+			return count, err
+		}
+		count += len(page)
+		truncated = budget.exhausted() || f.capped(count)
+	}
+
+	if !truncated {
+		for r := range f.Stream(ctx, query, numWorkers, pageLimit) {
+			page := f.capPage(r, count)
+			if err := handle(page); err != nil {
+				cp.flush()
+				f.record(count, false, time.Since(start), err)
+				return count, err
+			}
+			count += len(page)
+			cp.add(page)
+
+			if budget.exhausted() {
+				f.client.Logger.Warnf("Run record budget of %d reached while fetching %s, stopping early", budget.limit, f.Entity())
+				truncated = true
+				break
+			}
+			if f.capped(count) {
+				// Returning cancels ctx, which stops the workers and lets Stream close its channel
+				f.client.Logger.Infof("Reached MAX_RECORDS of %d for %s, stopping early", f.client.MaxRecords, f.Entity())
+				truncated = true
+				break
+			}
+		}
+	}
+
+	// A cancelled run returns the context error rather than a partial result
+	if err := f.ctx.Err(); err != nil {
+		cp.flush()
+		err = fmt.Errorf("Fetching %s cancelled: %w", f.Entity(), err)
+		f.record(count, false, time.Since(start), err)
+		return count, err
+	}
+
+	err := f.pages.err(f.Entity())
+	if err != nil {
+		cp.flush()
+	} else {
+		cp.clear()
+	}
+	f.record(count, truncated, time.Since(start), err)
+
+	return count, err
+}
+
+// capPage trims page to what the per-entity cap and the run budget still allow, given count
+// records already handled.
+func (f *Fetcher[T]) capPage(page []T, count int) []T {
+	if f.client.MaxRecords > 0 {
+		page = page[:min(len(page), max(f.client.MaxRecords-count, 0))]
+	}
+	return page[:f.client.Budget.take(len(page))]
+}
+
+// capped reports whether count has reached the per-entity cap.
+func (f *Fetcher[T]) capped(count int) bool {
+	return f.client.MaxRecords > 0 && count >= f.client.MaxRecords
+}
+
+// FetchAll fetches every page of query. If any pages fail, the records that were fetched are
+// returned together with a *FetchError describing the failures. Records seen more than once,
+// e.g. because the data shifted between offset pages mid-run, are returned only once.
+func (f *Fetcher[T]) FetchAll(query string, numWorkers, pageLimit int) ([]T, error) {
+	var results []T
+	_, err := f.FetchEach(query, numWorkers, pageLimit, func(page []T) error {
+		results = append(results, page...)
+		if f.OnPage != nil {
+			f.OnPage(page)
+		}
+		return nil
+	})
+
+	results, dropped := dedupe(results)
+	if dropped > 0 {
+		f.client.Logger.Warnf("Dropped %d duplicate %s records", dropped, f.Entity())
+	}
+	return results, err
+}
+
+// dedupe removes records whose ID was already seen, keeping the first occurrence.
+func dedupe[T Entity](records []T) ([]T, int) {
+	seen := make(map[int]bool, len(records))
+	kept := records[:0]
+	for _, r := range records {
+		id := r.GetID()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		kept = append(kept, r)
+	}
+	return kept, len(records) - len(kept)
+}
@@ -0,0 +1,254 @@
+package igdb
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// offsetOf returns the offset of an "offset-<n>" page, or -1 for other pages.
+func offsetOf(page string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(page, "offset-"))
+	if err != nil || !strings.HasPrefix(page, "offset-") {
+		return -1
+	}
+	return n
+}
+
+func TestFetchAllResumesAbandonedStride(t *testing.T) {
+	// Worker 1 of 2 owns offsets 10, 30, 50, ...; its first three pages fail once, so it gives
+	// up on its stride. The retry pass has to fetch the rest of that stride as well.
+	srv := &fakeIGDB{total: 300, fail: func(page string, attempt int) bool {
+		offset := offsetOf(page)
+		return attempt == 1 && (offset == 10 || offset == 30 || offset == 50)
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	genres, err := f.FetchAll("fields id, name;", 2, 10)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, genres, 300)
+}
+
+func TestFetchAllReportsIncompleteStride(t *testing.T) {
+	// Everything from offset 70 on in worker 1's stride keeps failing after the worker gives up
+	srv := &fakeIGDB{total: 300, fail: func(page string, attempt int) bool {
+		offset := offsetOf(page)
+		if offset == 10 || offset == 30 || offset == 50 {
+			return attempt == 1
+		}
+		return offset >= 70 && offset%20 == 10
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	genres, err := f.FetchAll("fields id, name;", 2, 10)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("FetchAll error = %v, want a *FetchError", err)
+	}
+	if !fetchErr.Incomplete {
+		t.Errorf("FetchError.Incomplete = false, want true")
+	}
+	if len(genres) >= 300 {
+		t.Errorf("got %d genres, want fewer than 300", len(genres))
+	}
+}
+
+func TestFetchAllRetriesFailedPages(t *testing.T) {
+	srv := &fakeIGDB{total: 95, fail: func(page string, attempt int) bool {
+		return attempt == 1 && (page == "offset-20" || page == "offset-60")
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	genres, err := f.FetchAll("fields id, name;", 4, 10)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, genres, 95)
+}
+
+// TestStreamManyPages runs the pool over many pages with a consumer slower than the workers
+// and scattered page failures. Run it with -race to check the pool's shared state.
+func TestStreamManyPages(t *testing.T) {
+	srv := &fakeIGDB{total: 5003, fail: func(page string, attempt int) bool {
+		return attempt == 1 && offsetOf(page)%170 == 0
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	var genres []Genre
+	for page := range f.Stream(context.Background(), "fields id, name;", 16, 10) {
+		if len(genres)%500 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		genres = append(genres, page...)
+	}
+	if err := f.pages.err(f.Entity()); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	assertAllGenres(t, genres, 5003)
+}
+
+func TestFetchAllPagination(t *testing.T) {
+	tests := []struct {
+		name             string
+		total, pageLimit int
+		workers          int
+	}{
+		{"partial last page", 95, 10, 4},
+		{"exact multiple of the page limit", 100, 10, 4},
+		{"fewer records than one page", 7, 10, 4},
+		{"empty dataset", 0, 10, 4},
+		{"single worker", 55, 10, 1},
+		{"more workers than pages", 25, 10, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &fakeIGDB{total: tt.total}
+			f := newGenresFetcher(newTestClient(t, srv))
+
+			genres, err := f.FetchAll("fields id, name;", tt.workers, tt.pageLimit)
+			if err != nil {
+				t.Fatalf("FetchAll: %v", err)
+			}
+			assertAllGenres(t, genres, tt.total)
+
+			// Each worker stops at its first partial page, so at most one request per worker
+			// goes past the data
+			pages := (tt.total + tt.pageLimit - 1) / tt.pageLimit
+			if srv.requests > pages+tt.workers {
+				t.Errorf("made %d requests for %d pages with %d workers", srv.requests, pages, tt.workers)
+			}
+		})
+	}
+}
+
+func TestFetchAllMidStreamError(t *testing.T) {
+	srv := &fakeIGDB{total: 95, fail: func(page string, attempt int) bool {
+		return page == "offset-40"
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	genres, err := f.FetchAll("fields id, name;", 4, 10)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("FetchAll error = %v, want a *FetchError", err)
+	}
+	if fetchErr.Failed != 1 || fetchErr.Offsets[0] != 40 {
+		t.Errorf("failed pages = %d at %v, want 1 at offset 40", fetchErr.Failed, fetchErr.Offsets)
+	}
+	if len(genres) != 85 {
+		t.Errorf("got %d genres, want the 85 outside the failed page", len(genres))
+	}
+}
+
+// TestFetchAllNoDeadlock fetches with every worker count up to MaxWorkers, and past it, under
+// a deadline, so a pool that blocks on its own channels fails instead of hanging.
+func TestFetchAllNoDeadlock(t *testing.T) {
+	for _, workers := range []int{1, 2, 5, 6, 8, 16, 31, MaxWorkers, MaxWorkers + 8} {
+		t.Run(strconv.Itoa(workers), func(t *testing.T) {
+			srv := &fakeIGDB{total: 1234}
+			f := newGenresFetcher(newTestClient(t, srv))
+
+			done := make(chan []Genre)
+			go func() {
+				genres, err := f.FetchAll("fields id, name;", workers, 10)
+				if err != nil {
+					t.Errorf("FetchAll: %v", err)
+				}
+				done <- genres
+			}()
+
+			select {
+			case genres := <-done:
+				assertAllGenres(t, genres, 1234)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("FetchAll with %d workers didn't finish", workers)
+			}
+		})
+	}
+}
+
+// TestStreamCancelStopsWorkers stops consuming a stream after its first page with many
+// workers still sending. Run it with -race; once ctx is cancelled every worker has to stop
+// after at most the page it holds, which closes the stream.
+func TestStreamCancelStopsWorkers(t *testing.T) {
+	f := newGenresFetcher(newTestClient(t, &fakeIGDB{total: 20000}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pages := f.Stream(ctx, "fields id, name;", MaxWorkers, 10)
+	<-pages
+	cancel()
+
+	received := 0
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case _, ok := <-pages:
+			if !ok {
+				if received > MaxWorkers {
+					t.Errorf("received %d pages after cancelling, want at most one per worker", received)
+				}
+				return
+			}
+			received++
+		case <-deadline:
+			t.Fatal("stream wasn't closed after cancelling its context")
+		}
+	}
+}
+
+// TestFetchAllCapStopsWorkers stops fetches early through MAX_RECORDS and the run budget with
+// many workers still sending pages. Run it with -race; it also checks that no worker is left
+// blocked once FetchAll returns.
+func TestFetchAllCapStopsWorkers(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	for _, tt := range []struct {
+		name  string
+		setup func(*Client)
+	}{
+		{"max records", func(c *Client) { c.MaxRecords = 137 }},
+		{"run budget", func(c *Client) { c.Budget = NewRecordBudget(137) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newInProcessClient(&fakeIGDB{total: 20000})
+			tt.setup(client)
+			f := newGenresFetcher(client)
+
+			genres, err := f.FetchAll("fields id, name;", MaxWorkers, 10)
+			if err != nil {
+				t.Fatalf("FetchAll: %v", err)
+			}
+			if len(genres) != 137 {
+				t.Errorf("got %d genres, want 137", len(genres))
+			}
+		})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("%d goroutines still running after the capped fetches, want %d", n, baseline)
+	}
+}
+
+func TestFetchAllOnPage(t *testing.T) {
+	srv := &fakeIGDB{total: 95}
+	f := newGenresFetcher(newTestClient(t, srv))
+
+	var seen []Genre
+	f.OnPage = func(page []Genre) {
+		seen = append(seen, page...)
+	}
+	if _, err := f.FetchAll("fields id, name;", 4, 10); err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, seen, 95)
+}
@@ -0,0 +1,106 @@
+package igdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fieldsClause matches the fields clause of an Apicalypse query, capturing its field list.
+var fieldsClause = regexp.MustCompile(`(?i)\bfields\s+([^;]*);`)
+
+// quotedName matches a quoted identifier in an IGDB error message, e.g. 'rating' or "cover.url".
+var quotedName = regexp.MustCompile("['\"`]([A-Za-z0-9_.]+)['\"`]")
+
+// apiErrorBody is one entry of the JSON array IGDB sends with a 400.
+type apiErrorBody struct {
+	Title string `json:"title"`
+	Cause string `json:"cause"`
+}
+
+// queryFields returns the fields requested by query, in order.
+func queryFields(query string) []string {
+	m := fieldsClause.FindStringSubmatch(query)
+	if m == nil {
+		return nil
+	}
+	var fields []string
+	for _, field := range strings.Split(m[1], ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// withoutFields returns query with dropped removed from its fields clause.
+func withoutFields(query string, dropped []string) string {
+	if len(dropped) == 0 {
+		return query
+	}
+	fields := slices.DeleteFunc(queryFields(query), func(field string) bool {
+		return slices.Contains(dropped, field)
+	})
+	return fieldsClause.ReplaceAllLiteralString(query, "fields "+strings.Join(fields, ", ")+";")
+}
+
+// unknownField returns the field of query that a 400 response rejected, when its error body
+// says a field is invalid and names one of the fields requested. It never names the last
+// remaining field, since a query without fields can't succeed either.
+func unknownField(err error, query string) (string, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return "", false
+	}
+	fields := queryFields(query)
+	if len(fields) < 2 {
+		return "", false
+	}
+
+	messages := []string{apiErr.Body}
+	var bodies []apiErrorBody
+	if json.Unmarshal([]byte(apiErr.Body), &bodies) == nil {
+		messages = messages[:0]
+		for _, b := range bodies {
+			messages = append(messages, b.Title+": "+b.Cause)
+		}
+	}
+
+	for _, msg := range messages {
+		if !strings.Contains(strings.ToLower(msg), "field") {
+			continue
+		}
+		for _, m := range quotedName.FindAllStringSubmatch(msg, -1) {
+			if slices.Contains(fields, m[1]) {
+				return m[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// droppedFields is the set of fields a Fetcher stopped requesting after IGDB rejected them.
+// It's shared by every worker of the fetch.
+type droppedFields struct {
+	mu     sync.Mutex
+	fields []string
+}
+
+func (d *droppedFields) add(field string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.fields, field) {
+		d.fields = append(d.fields, field)
+	}
+}
+
+// apply returns query without the dropped fields.
+func (d *droppedFields) apply(query string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return withoutFields(query, d.fields)
+}
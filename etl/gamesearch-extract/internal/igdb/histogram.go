@@ -0,0 +1,78 @@
+package igdb
+
+import (
+	"sync"
+	"time"
+)
+
+// Fixed upper bounds for page latency buckets; anything slower lands in an overflow bucket.
+var latencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// latencyHistogram is a lightweight fixed-bucket histogram safe for concurrent use.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts []int
+	total  int
+	max    time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]int, len(latencyBuckets)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile returns the upper bound of the bucket containing the p-th percentile (0-100).
+// Observations in the overflow bucket report the slowest latency seen.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := int(float64(h.total)*p/100 + 0.5)
+	rank = max(rank, 1)
+	seen := 0
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) log(logger Logger, entity string) {
+	h.mu.Lock()
+	pages := h.total
+	h.mu.Unlock()
+
+	logger.Infof("Page latency summary for %s: pages=%d p50=%s p90=%s p99=%s",
+		entity, pages, h.percentile(50), h.percentile(90), h.percentile(99))
+}
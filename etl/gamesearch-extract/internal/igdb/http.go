@@ -0,0 +1,35 @@
+package igdb
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultRequestTimeout bounds a single IGDB request attempt unless IGDB_REQUEST_TIMEOUT is set.
+const DefaultRequestTimeout = 30 * time.Second
+
+// NewHTTPClient returns the client shared by every fetcher in a run, and by the token source
+// for Twitch auth. Reusing one transport keeps connections to IGDB alive between pages instead
+// of paying a TLS handshake each time. Requests go through proxy when it is set, and
+// otherwise through the HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables.
+//
+// The client's own timeout bounds a whole request, including reading the response body, at
+// twice requestTimeout (DefaultRequestTimeout when zero). It backs up the per-attempt deadline
+// and bounds token requests, and grows with requestTimeout so it never cuts an attempt short.
+func NewHTTPClient(proxy *url.URL, requestTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = MaxWorkers
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if requestTimeout == 0 {
+		requestTimeout = DefaultRequestTimeout
+	}
+	return &http.Client{
+		Timeout:   2 * requestTimeout,
+		Transport: transport,
+	}
+}
@@ -0,0 +1,22 @@
+package igdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientTimeoutFollowsRequestTimeout(t *testing.T) {
+	tests := []struct {
+		requestTimeout time.Duration
+		want           time.Duration
+	}{
+		{0, 2 * DefaultRequestTimeout},
+		{10 * time.Second, 20 * time.Second},
+		{2 * time.Minute, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := NewHTTPClient(nil, tt.requestTimeout).Timeout; got != tt.want {
+			t.Errorf("NewHTTPClient(nil, %s).Timeout = %s, want %s", tt.requestTimeout, got, tt.want)
+		}
+	}
+}
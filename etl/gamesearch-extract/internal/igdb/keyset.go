@@ -0,0 +1,119 @@
+package igdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Pagination selects how a Fetcher walks through an endpoint's records.
+type Pagination string
+
+const (
+	// PaginationOffset pages with limit/offset across the worker pool. IGDB rejects offsets
+	// above MaxOffset, so it only suits endpoints smaller than that.
+	PaginationOffset Pagination = "offset"
+	// PaginationKeyset pages sequentially with "where id > <last id>" sorted by id, which has
+	// no offset cap but can only use a single worker since each page depends on the last.
+	PaginationKeyset Pagination = "keyset"
+)
+
+// MaxOffset is the largest offset IGDB accepts.
+const MaxOffset = 10000
+
+func ParsePagination(value string, fallback Pagination) (Pagination, error) {
+	switch p := Pagination(value); p {
+	case "":
+		return fallback, nil
+	case PaginationOffset, PaginationKeyset:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid pagination %q, expected offset or keyset", value)
+}
+
+// whereClause matches the single where clause an apicalypse query may contain.
+var whereClause = regexp.MustCompile(`(?m)^\s*where\s+(.*?);\s*$`)
+
+// keysetQuery adds the id > lastID condition to query, merging it into an existing where
+// clause since IGDB only accepts one.
+func keysetQuery(query string, lastID, pageLimit int) string {
+	condition := fmt.Sprintf("id > %d", lastID)
+	if loc := whereClause.FindStringSubmatchIndex(query); loc != nil {
+		query = query[:loc[0]] + fmt.Sprintf("where (%s) & %s;", query[loc[2]:loc[3]], condition) + query[loc[1]:]
+	} else {
+		query += fmt.Sprintf("\nwhere %s;", condition)
+	}
+	return query + fmt.Sprintf("\nsort id asc;\nlimit %d;", pageLimit)
+}
+
+// keysetPageRetries is how many more times a failed keyset page is requested before the walk
+// gives up, since every later page depends on it.
+const keysetPageRetries = 2
+
+// streamKeyset is the keyset counterpart to the worker pool in Stream. Pages are fetched one
+// after another, each starting after the last ID of the previous page, until a partial page
+// is returned. A failed page is retried up to keysetPageRetries times; if it still fails the
+// fetch ends there and is marked incomplete, since the next page can't be located without it.
+// A fetch resumed from a checkpoint starts after the checkpoint's last ID.
+func (f *Fetcher[T]) streamKeyset(ctx context.Context, query string, pageLimit int) <-chan []T {
+	resultChan := make(chan []T)
+	timings := newLatencyHistogram()
+
+	go func() {
+		defer close(resultChan)
+
+		lastID := f.startID
+		for {
+			if err := f.client.Limiter.Wait(ctx); err != nil {
+				if ctx.Err() == nil {
+					f.client.Logger.Errorf("Error rate limiting requests: %v", err)
+				}
+				break
+			}
+
+			res, returned, err := f.fetchKeysetPage(query, lastID, pageLimit, timings)
+			for retry := 1; err != nil && retry <= keysetPageRetries && ctx.Err() == nil; retry++ {
+				f.client.Logger.Warnf("Error fetching results after ID %d, retrying (%d of %d): %v", lastID, retry, keysetPageRetries, err)
+				if err := f.client.Limiter.Wait(ctx); err != nil {
+					break
+				}
+				res, returned, err = f.fetchKeysetPage(query, lastID, pageLimit, timings)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				f.client.Logger.Errorf("Error fetching results after ID %d, stopping the fetch: %v\n", lastID, err)
+				f.pages.fail(lastID, err)
+				f.pages.markIncomplete()
+				break
+			}
+			if len(res) == 0 && returned == pageLimit {
+				// Every record was skipped as malformed, so there's no ID to continue after
+				f.client.Logger.Errorf("No decodable %s records in the full page after ID %d", f.Entity(), lastID)
+				f.pages.fail(lastID, fmt.Errorf("every record in the page was malformed"))
+				f.pages.markIncomplete()
+				break
+			}
+			f.pages.success()
+
+			select {
+			case resultChan <- res:
+			case <-ctx.Done():
+				return
+			}
+
+			f.client.Logger.Infof("Queried results after ID %d\n", lastID)
+
+			if returned < pageLimit {
+				break
+			}
+			lastID = res[len(res)-1].GetID()
+		}
+
+		f.client.Logger.Infof("Keyset pagination finished.")
+		timings.log(f.client.Logger, f.Entity())
+	}()
+
+	return resultChan
+}
@@ -0,0 +1,37 @@
+package igdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeysetFetchRetriesFailedPage(t *testing.T) {
+	srv := &fakeIGDB{total: 1000, fail: func(page string, attempt int) bool {
+		return page == "after-500" && attempt <= keysetPageRetries
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+	f.Pagination = PaginationKeyset
+
+	genres, err := f.FetchAll("fields id, name;", 1, 100)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	assertAllGenres(t, genres, 1000)
+}
+
+func TestKeysetFetchFailureIsIncomplete(t *testing.T) {
+	srv := &fakeIGDB{total: 1000, fail: func(page string, attempt int) bool {
+		return page == "after-500"
+	}}
+	f := newGenresFetcher(newTestClient(t, srv))
+	f.Pagination = PaginationKeyset
+
+	genres, err := f.FetchAll("fields id, name;", 1, 100)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || !fetchErr.Incomplete {
+		t.Fatalf("FetchAll error = %v, want an incomplete *FetchError", err)
+	}
+	if len(genres) != 500 {
+		t.Errorf("got %d genres, want the 500 before the failed page", len(genres))
+	}
+}
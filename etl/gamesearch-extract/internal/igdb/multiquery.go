@@ -0,0 +1,169 @@
+package igdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxMultiQueries is the most queries IGDB accepts in a single multiquery request.
+const MaxMultiQueries = 10
+
+// MultiQuery is one named query in a multiquery request.
+type MultiQuery struct {
+	// Name identifies the query's results and must be unique within a request
+	Name     string
+	Endpoint string
+	// Query holds the fields and optional where clause; FetchMulti adds the paging
+	Query string
+}
+
+// MultiResult is everything FetchMulti fetched for one query.
+type MultiResult struct {
+	// Pages holds each page's records as a JSON array
+	Pages []json.RawMessage
+	// Err is a *FetchError if a request failed before the query's last page
+	Err error
+}
+
+// DecodeMulti decodes a query's pages into records, returning them alongside the result's
+// error so partial results can be kept like those of FetchAll.
+func DecodeMulti[T Entity](result *MultiResult) ([]T, error) {
+	if result == nil {
+		return nil, nil
+	}
+
+	var records []T
+	for _, page := range result.Pages {
+		var res []T
+		if err := json.Unmarshal(page, &res); err != nil {
+			return records, &DecodeError{Err: err}
+		}
+		records = append(records, res...)
+	}
+	return records, result.Err
+}
+
+// FetchMulti pages through several endpoints at once using IGDB's multiquery endpoint, asking
+// for the next page of every unfinished query in each request. Queries page by ID like
+// PaginationKeyset, so none of them run into the offset cap. A failed request is retried up to
+// keysetPageRetries times; if it still fails, every query that was still running ends there
+// with an incomplete *FetchError, since their next pages can't be located without it.
+func (c *Client) FetchMulti(ctx context.Context, queries []MultiQuery, pageLimit int) (map[string]*MultiResult, error) {
+	if len(queries) > MaxMultiQueries {
+		return nil, fmt.Errorf("Too many queries for one multiquery request: %d > %d", len(queries), MaxMultiQueries)
+	}
+
+	url := c.endpointURL("multiquery")
+	results := make(map[string]*MultiResult, len(queries))
+	lastIDs := make(map[string]int, len(queries))
+	for _, q := range queries {
+		results[q.Name] = new(MultiResult)
+	}
+
+	pending := queries
+	for len(pending) > 0 {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return results, err
+		}
+
+		var body strings.Builder
+		for _, q := range pending {
+			fmt.Fprintf(&body, "query %s \"%s\" {\n%s\n};\n", q.Endpoint, q.Name, keysetQuery(q.Query, lastIDs[q.Name], pageLimit))
+		}
+
+		c.Logger.Debugf("Querying multiquery: %q", body.String())
+
+		var resp []struct {
+			Name   string          `json:"name"`
+			Result json.RawMessage `json:"result"`
+		}
+		var err error
+		for attempt := 0; attempt <= keysetPageRetries; attempt++ {
+			if attempt > 0 {
+				c.Logger.Warnf("Error fetching multiquery page, retrying (%d of %d): %v", attempt, keysetPageRetries, err)
+				if err := c.Limiter.Wait(ctx); err != nil {
+					return results, err
+				}
+			}
+			start := time.Now()
+			err = c.withRetry(ctx, "multiquery", func(authorization string) error {
+				resp = nil
+				return c.post(ctx, url, body.String(), authorization, &resp)
+			})
+			if c.Recorder != nil {
+				c.Recorder.RecordRequest("multiquery", time.Since(start), err)
+			}
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		if err != nil {
+			c.Logger.Errorf("Error fetching multiquery page: %v", err)
+			for _, q := range pending {
+				r := results[q.Name]
+				r.Err = &FetchError{
+					Entity:     q.Endpoint,
+					Pages:      len(r.Pages) + 1,
+					Failed:     1,
+					Offsets:    []int{lastIDs[q.Name]},
+					Incomplete: true,
+					Err:        fmt.Errorf("after ID %d: %w", lastIDs[q.Name], err),
+				}
+			}
+			return results, nil
+		}
+
+		finished := make(map[string]bool, len(pending))
+		returned := make(map[string]bool, len(pending))
+		for _, named := range resp {
+			r, ok := results[named.Name]
+			if !ok {
+				continue
+			}
+			returned[named.Name] = true
+			var ids []struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(named.Result, &ids); err != nil {
+				return results, &DecodeError{Err: err}
+			}
+
+			r.Pages = append(r.Pages, named.Result)
+			if len(ids) < pageLimit {
+				finished[named.Name] = true
+			} else {
+				lastIDs[named.Name] = ids[len(ids)-1].ID
+			}
+		}
+
+		var next []MultiQuery
+		for _, q := range pending {
+			switch {
+			case finished[q.Name]:
+			case !returned[q.Name]:
+				// A query missing from the response can't advance, so it ends here
+				r := results[q.Name]
+				r.Err = &FetchError{
+					Entity:     q.Endpoint,
+					Pages:      len(r.Pages) + 1,
+					Failed:     1,
+					Offsets:    []int{lastIDs[q.Name]},
+					Incomplete: true,
+					Err:        fmt.Errorf("after ID %d: no results returned for query %q", lastIDs[q.Name], q.Name),
+				}
+			default:
+				next = append(next, q)
+			}
+		}
+		c.Logger.Infof("Queried multiquery page of %d queries, %d still running", len(pending), len(next))
+		pending = next
+	}
+
+	return results, nil
+}
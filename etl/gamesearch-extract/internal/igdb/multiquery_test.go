@@ -0,0 +1,102 @@
+package igdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var multiBlock = regexp.MustCompile(`(?s)query \w+ "([^"]+)" \{\n(.*?)\n\};`)
+
+// fakeMultiquery answers multiquery requests with every named query served by catalogs,
+// failing the requests for which fail returns true (numbered from 1).
+type fakeMultiquery struct {
+	catalogs map[string]*fakeIGDB
+	fail     func(request int) bool
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (s *fakeMultiquery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests++
+	request := s.requests
+	s.mu.Unlock()
+	if s.fail != nil && s.fail(request) {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	type named struct {
+		Name   string  `json:"name"`
+		Result []Genre `json:"result"`
+	}
+	var resp []named
+	for _, m := range multiBlock.FindAllStringSubmatch(string(body), -1) {
+		limit, _ := strconv.Atoi(limitPattern.FindStringSubmatch(m[2])[1])
+		after, _ := strconv.Atoi(afterPattern.FindStringSubmatch(m[2])[1])
+		resp = append(resp, named{Name: m[1], Result: s.catalogs[m[1]].records(after, limit)})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func fetchMultiGenres(t *testing.T, srv *fakeMultiquery) (map[string][]Genre, map[string]error) {
+	t.Helper()
+	client := newTestClient(t, srv)
+	results, err := client.FetchMulti(context.Background(), []MultiQuery{
+		{Name: "small", Endpoint: "genres", Query: "fields id, name;"},
+		{Name: "large", Endpoint: "genres", Query: "fields id, name;"},
+	}, 100)
+	if err != nil {
+		t.Fatalf("FetchMulti: %v", err)
+	}
+
+	records := make(map[string][]Genre)
+	errs := make(map[string]error)
+	for name, result := range results {
+		records[name], errs[name] = DecodeMulti[Genre](result)
+	}
+	return records, errs
+}
+
+func TestFetchMultiRetriesFailedRequest(t *testing.T) {
+	srv := &fakeMultiquery{
+		catalogs: map[string]*fakeIGDB{"small": {total: 150}, "large": {total: 1000}},
+		fail:     func(request int) bool { return request == 3 || request == 4 },
+	}
+
+	records, errs := fetchMultiGenres(t, srv)
+	for name, err := range errs {
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	assertAllGenres(t, records["small"], 150)
+	assertAllGenres(t, records["large"], 1000)
+}
+
+func TestFetchMultiFailureIsIncomplete(t *testing.T) {
+	srv := &fakeMultiquery{
+		catalogs: map[string]*fakeIGDB{"small": {total: 150}, "large": {total: 1000}},
+		fail:     func(request int) bool { return request >= 4 },
+	}
+
+	records, errs := fetchMultiGenres(t, srv)
+	assertAllGenres(t, records["small"], 150)
+	var fetchErr *FetchError
+	if !errors.As(errs["large"], &fetchErr) || !fetchErr.Incomplete {
+		t.Fatalf("large error = %v, want an incomplete *FetchError", errs["large"])
+	}
+	if len(records["large"]) != 300 {
+		t.Errorf("got %d large records, want the 300 before the failed request", len(records["large"]))
+	}
+}
@@ -0,0 +1,23 @@
+package igdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Ping requests a single record from endpoint to confirm that IGDB is reachable and accepts
+// the client's token. Unlike the fetchers it makes one attempt without retrying, so a
+// broken setup fails immediately.
+func (c *Client) Ping(ctx context.Context, endpoint string) error {
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return err
+	}
+	authorization, err := c.Tokens.get()
+	if err != nil {
+		return fmt.Errorf("Error retrieving authentication token: %w", err)
+	}
+
+	var out []json.RawMessage
+	return c.post(ctx, c.endpointURL(endpoint), "fields id;\nlimit 1;", authorization, &out)
+}
@@ -0,0 +1,139 @@
+package igdb
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// defaultRateLimitCooldown is how long to back off after a 429 without a Retry-After header.
+const defaultRateLimitCooldown = 2 * time.Second
+
+// budgetLogInterval throttles how often the observed request budget is logged.
+const budgetLogInterval = 30 * time.Second
+
+// AIMD tuning for adaptive limiters: each 429 multiplies the rate by aimdDecrease, and every
+// aimdIncreaseAfter consecutive successes add aimdIncreaseStep requests per second back.
+const (
+	aimdDecrease      = 0.5
+	aimdIncreaseStep  = 0.25
+	aimdIncreaseAfter = 20
+)
+
+// BudgetLimiter wraps the shared rate limiter and slows it down when IGDB reports a nearly
+// exhausted request budget, restoring the configured rate once the budget recovers.
+type BudgetLimiter struct {
+	*rate.Limiter
+
+	mu          sync.Mutex
+	base        rate.Limit
+	lastLogged  time.Time
+	pausedUntil time.Time
+
+	// adaptive limiters move base between floor and ceiling as requests succeed or hit 429s
+	adaptive       bool
+	floor, ceiling rate.Limit
+	successes      int
+}
+
+func NewBudgetLimiter(r rate.Limit, burst int) *BudgetLimiter {
+	return &BudgetLimiter{Limiter: rate.NewLimiter(r, burst), base: r}
+}
+
+// NewAdaptiveLimiter returns a limiter that starts at ceiling and adapts its rate with AIMD:
+// it halves on every 429, down to floor, and creeps back up towards ceiling after a stretch
+// of successful requests.
+func NewAdaptiveLimiter(ceiling, floor rate.Limit, burst int) *BudgetLimiter {
+	b := NewBudgetLimiter(ceiling, burst)
+	b.adaptive = true
+	b.floor = floor
+	b.ceiling = ceiling
+	return b
+}
+
+// rateLimited applies the multiplicative decrease after a 429.
+func (b *BudgetLimiter) rateLimited(logger Logger) {
+	if !b.adaptive {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.successes = 0
+	b.base = max(b.base*aimdDecrease, b.floor)
+	b.SetLimit(min(b.Limit(), b.base))
+	logger.Warnf("Rate limited by IGDB, reducing request rate to %.2f/s", float64(b.base))
+}
+
+// succeeded counts a successful request towards the next additive increase.
+func (b *BudgetLimiter) succeeded(logger Logger) {
+	if !b.adaptive {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.successes++
+	if b.successes < aimdIncreaseAfter || b.base >= b.ceiling {
+		return
+	}
+	b.successes = 0
+	b.base = min(b.base+aimdIncreaseStep, b.ceiling)
+	b.SetLimit(b.base)
+	logger.Infof("Increasing request rate to %.2f/s", float64(b.base))
+}
+
+// Wait blocks until any pause requested by a 429 has elapsed and the limiter allows a request.
+func (b *BudgetLimiter) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	until := b.pausedUntil
+	b.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+	return b.Limiter.Wait(ctx)
+}
+
+// pause holds back every worker sharing the limiter for at least d.
+func (b *BudgetLimiter) pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// observe tunes the limiter from X-RateLimit-Remaining and X-RateLimit-Reset (seconds until
+// the budget resets). Responses without these headers leave the limiter untouched.
+func (b *BudgetLimiter) observe(h http.Header, logger Logger) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	limit := b.base
+	if reset, err := strconv.ParseFloat(h.Get("X-RateLimit-Reset"), 64); err == nil && reset > 0 {
+		limit = min(b.base, max(rate.Limit(float64(remaining)/reset), 0.1))
+	} else if remaining <= 1 {
+		limit = b.base / 2
+	}
+
+	if limit != b.Limit() {
+		b.SetLimit(limit)
+	}
+
+	if time.Since(b.lastLogged) >= budgetLogInterval {
+		b.lastLogged = time.Now()
+		logger.Infof("Observed IGDB request budget: remaining=%d rate=%.2f", remaining, float64(b.Limit()))
+	}
+}
@@ -0,0 +1,51 @@
+package igdb
+
+import (
+	"encoding/json"
+)
+
+// RawStore keeps the response bodies of fetched pages as IGDB sent them, so a decode problem
+// can be told apart from bad data upstream.
+type RawStore interface {
+	// SaveRaw stores body for the page of entity identified by page, e.g. its offset.
+	SaveRaw(entity, page string, body []byte) error
+}
+
+// saveRaw hands body to the client's RawStore. Failures are only logged, since the raw copy
+// is a debugging aid and shouldn't fail the fetch.
+func (f *Fetcher[T]) saveRaw(page string, body []byte) {
+	if f.client.RawResponses == nil || page == "" {
+		return
+	}
+	if err := f.client.RawResponses.SaveRaw(f.Entity(), page, body); err != nil {
+		f.client.Logger.Warnf("Error saving raw %s response for page %s: %v", f.Entity(), page, err)
+	}
+}
+
+// decodePage decodes a page of records from body. With LenientDecode each record is decoded
+// on its own, so one that doesn't match T is logged and skipped while the rest of the page is
+// kept. It returns how many records the page held, skipped ones included.
+func (f *Fetcher[T]) decodePage(body []byte) ([]T, int, error) {
+	if !f.client.LenientDecode {
+		var results []T
+		if err := json.Unmarshal(body, &results); err != nil {
+			return nil, 0, &DecodeError{Err: err}
+		}
+		return results, len(results), nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, 0, &DecodeError{Err: err}
+	}
+	results := make([]T, 0, len(raw))
+	for i, r := range raw {
+		var record T
+		if err := json.Unmarshal(r, &record); err != nil {
+			f.client.Logger.Warnf("Skipping malformed %s record %d of %d: %v", f.Entity(), i+1, len(raw), err)
+			continue
+		}
+		results = append(results, record)
+	}
+	return results, len(raw), nil
+}
@@ -0,0 +1,91 @@
+package igdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed IGDB requests are retried with exponential backoff.
+type RetryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{maxRetries: 5, baseDelay: 500 * time.Millisecond}
+
+const (
+	// maxRetryDelay caps the backoff before jitter, however many attempts came before
+	maxRetryDelay = 30 * time.Second
+	// MaxRetries is the most retries IGDB_MAX_RETRIES may ask for
+	MaxRetries = 10
+)
+
+// LoadRetryPolicy reads IGDB_MAX_RETRIES and IGDB_RETRY_BASE_DELAY (a Go duration such as "500ms").
+func LoadRetryPolicy() (*RetryPolicy, error) {
+	policy := defaultRetryPolicy
+
+	if v := os.Getenv("IGDB_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > MaxRetries {
+			return nil, fmt.Errorf("Invalid IGDB_MAX_RETRIES %q: must be between 0 and %d", v, MaxRetries)
+		}
+		policy.maxRetries = n
+	}
+
+	if v := os.Getenv("IGDB_RETRY_BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("Invalid IGDB_RETRY_BASE_DELAY %q: must be a positive duration", v)
+		}
+		policy.baseDelay = d
+	}
+
+	return &policy, nil
+}
+
+// backoff returns the delay before retry number attempt (starting at 0): the base delay doubled
+// per attempt up to maxRetryDelay, with the upper half randomized so concurrent workers don't
+// retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := min(p.baseDelay, maxRetryDelay)
+	for range attempt {
+		if d >= maxRetryDelay/2 {
+			d = maxRetryDelay
+			break
+		}
+		d *= 2
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// isRetryable reports whether err is a transient failure: a network error or timeout, a 5xx
+// or a 429. Callers are responsible for not retrying once their own context is done.
+func isRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op != "parse"
+}
+
+// sleepContext waits for d, returning early with the context's error if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
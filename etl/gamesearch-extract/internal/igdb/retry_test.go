@@ -0,0 +1,49 @@
+package igdb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestBackoffIsCapped(t *testing.T) {
+	p := RetryPolicy{maxRetries: MaxRetries, baseDelay: 500 * time.Millisecond}
+	for attempt := range 100 {
+		if d := p.backoff(attempt); d <= 0 || d > maxRetryDelay {
+			t.Fatalf("backoff(%d) = %s, want within (0, %s]", attempt, d, maxRetryDelay)
+		}
+	}
+}
+
+func TestLoadRetryPolicyBoundsMaxRetries(t *testing.T) {
+	t.Setenv("IGDB_MAX_RETRIES", "40")
+	if _, err := LoadRetryPolicy(); err == nil {
+		t.Fatal("IGDB_MAX_RETRIES=40 was accepted")
+	}
+}
+
+func TestRetriesWaitForLimiter(t *testing.T) {
+	client := &Client{
+		Tokens:  &TokenSource{authorization: "Bearer test", expiresAt: time.Now().Add(time.Hour)},
+		Limiter: NewBudgetLimiter(rate.Every(50*time.Millisecond), 1),
+		Retry:   &RetryPolicy{maxRetries: 3, baseDelay: time.Microsecond},
+		Logger:  discardLogger{},
+	}
+
+	attempts := 0
+	start := time.Now()
+	err := client.withRetry(context.Background(), "genres", func(string) error {
+		attempts++
+		return &APIError{StatusCode: http.StatusInternalServerError}
+	})
+	if err == nil || attempts != 4 {
+		t.Fatalf("got %d attempts and error %v, want 4 failed attempts", attempts, err)
+	}
+	// The limiter starts with one token, so the second and third retries each wait a full interval
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("retries took %s, want them paced by the limiter", elapsed)
+	}
+}
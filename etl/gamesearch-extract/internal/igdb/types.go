@@ -0,0 +1,138 @@
+package igdb
+
+type AuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+type Game struct {
+	ID                  int               `json:"id"`
+	Name                string            `json:"name"`
+	Slug                string            `json:"slug"`
+	FirstReleaseDate    int               `json:"first_release_date"`
+	FirstReleaseDateISO string            `json:"first_release_date_iso,omitempty"`
+	Franchises          []int             `json:"franchises"`
+	Genres              []int             `json:"genres"`
+	Themes              []int             `json:"themes"`
+	Summary             string            `json:"summary"`
+	Localizations       []int             `json:"game_localizations"`
+	DLCs                []int             `json:"dlcs"`
+	MultiplayerModes    []int             `json:"multiplayer_modes"`
+	Platforms           []int             `json:"platforms"`
+	Ports               []int             `json:"ports"`
+	InvolvedCompanies   []int             `json:"involved_companies"`
+	Cover               int               `json:"cover,omitempty"`
+	AlternativeNames    []int             `json:"alternative_names"`
+	UpdatedAt           int64             `json:"updated_at"`
+	Rating              float64           `json:"rating,omitempty"`
+	RatingCount         int               `json:"rating_count,omitempty"`
+	AggregatedRating    float64           `json:"aggregated_rating,omitempty"`
+	StoreLinks          map[string]string `json:"store_links,omitempty"`
+	LocalizedTitles     map[string]string `json:"localized_titles,omitempty"`
+	AltNames            []string          `json:"alt_names,omitempty"`
+	GenreNames          []string          `json:"genre_names,omitempty"`
+	ThemeNames          []string          `json:"theme_names,omitempty"`
+	FranchiseNames      []string          `json:"franchise_names,omitempty"`
+	Developers          []string          `json:"developers,omitempty"`
+	Publishers          []string          `json:"publishers,omitempty"`
+	CoverURL            string            `json:"cover_url,omitempty"`
+	SearchText          string            `json:"search_text,omitempty"`
+	TextEmbeddings      []float32         `json:"text_embeddings,omitempty"`
+}
+
+type Genre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Theme is a game's narrative or stylistic theme, such as horror or science fiction.
+type Theme struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Franchise struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Games []int  `json:"games"`
+}
+
+type Cover struct {
+	ID      int    `json:"id"`
+	Game    int    `json:"game"`
+	Height  int    `json:"height"`
+	Width   int    `json:"width"`
+	URL     string `json:"url"`
+	ImageID string `json:"image_id"`
+}
+
+type ExternalGame struct {
+	ID       int    `json:"id"`
+	Category int    `json:"category"`
+	UID      string `json:"uid"`
+	URL      string `json:"url"`
+	Game     int    `json:"game"`
+}
+
+type GameLocalization struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Region int    `json:"region"`
+	Game   int    `json:"game"`
+}
+
+type Region struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+}
+
+type Platform struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Abbreviation string `json:"abbreviation"`
+}
+
+// AlternativeName is another title a game is known by, such as an abbreviation.
+type AlternativeName struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	Game    int    `json:"game"`
+}
+
+type Company struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// InvolvedCompany joins a game to a company along with the role the company played.
+type InvolvedCompany struct {
+	ID        int  `json:"id"`
+	Company   int  `json:"company"`
+	Game      int  `json:"game"`
+	Developer bool `json:"developer"`
+	Publisher bool `json:"publisher"`
+}
+
+// Entity is the set of IGDB record types a Fetcher can decode. Every type exposes its IGDB
+// ID through GetID so generic code such as dedup and keyset pagination can read it.
+type Entity interface {
+	Game | Genre | Theme | Franchise | Cover | ExternalGame | GameLocalization | Region | Platform |
+		Company | InvolvedCompany | AlternativeName
+	GetID() int
+}
+
+func (g Game) GetID() int             { return g.ID }
+func (g Genre) GetID() int            { return g.ID }
+func (t Theme) GetID() int            { return t.ID }
+func (f Franchise) GetID() int        { return f.ID }
+func (c Cover) GetID() int            { return c.ID }
+func (e ExternalGame) GetID() int     { return e.ID }
+func (l GameLocalization) GetID() int { return l.ID }
+func (r Region) GetID() int           { return r.ID }
+func (p Platform) GetID() int         { return p.ID }
+func (c Company) GetID() int          { return c.ID }
+func (i InvolvedCompany) GetID() int  { return i.ID }
+func (a AlternativeName) GetID() int  { return a.ID }
@@ -0,0 +1,78 @@
+package igdb
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// gamePayload is a games response record in the shape IGDB returns for the fields we request.
+const gamePayload = `[{
+	"id": 1942,
+	"name": "The Witcher 3: Wild Hunt",
+	"first_release_date": 1431993600,
+	"genres": [12, 31],
+	"franchises": [452],
+	"dlcs": [12503, 12504],
+	"multiplayer_modes": [],
+	"platforms": [6, 48, 49, 130],
+	"ports": [119388],
+	"summary": "RPG",
+	"updated_at": 1700000000
+}]`
+
+func TestDecodeGameArrays(t *testing.T) {
+	var games []Game
+	if err := json.Unmarshal([]byte(gamePayload), &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 {
+		t.Fatalf("decoded %d games, want 1", len(games))
+	}
+
+	g := games[0]
+	if !slices.Equal(g.DLCs, []int{12503, 12504}) {
+		t.Errorf("DLCs = %v", g.DLCs)
+	}
+	if g.MultiplayerModes == nil || len(g.MultiplayerModes) != 0 {
+		t.Errorf("MultiplayerModes = %#v, want an empty slice", g.MultiplayerModes)
+	}
+	if !slices.Equal(g.Ports, []int{119388}) {
+		t.Errorf("Ports = %v", g.Ports)
+	}
+	if !slices.Equal(g.Platforms, []int{6, 48, 49, 130}) {
+		t.Errorf("Platforms = %v", g.Platforms)
+	}
+}
+
+func TestGetID(t *testing.T) {
+	records := []interface{ GetID() int }{
+		Game{ID: 1},
+		Genre{ID: 2},
+		Franchise{ID: 3},
+		Cover{ID: 4},
+		ExternalGame{ID: 5},
+		GameLocalization{ID: 6},
+		Region{ID: 7},
+		Platform{ID: 8},
+		Company{ID: 9},
+		InvolvedCompany{ID: 10},
+		AlternativeName{ID: 11},
+	}
+	for i, r := range records {
+		if got := r.GetID(); got != i+1 {
+			t.Errorf("%T.GetID() = %d, want %d", r, got, i+1)
+		}
+	}
+}
+
+// idOf is generic over Entity, the way dedup and keyset pagination read IDs.
+func idOf[T Entity](record T) int {
+	return record.GetID()
+}
+
+func TestGetIDThroughEntityConstraint(t *testing.T) {
+	if idOf(Game{ID: 42}) != 42 || idOf(Genre{ID: 7}) != 7 {
+		t.Error("GetID through the Entity constraint returned the wrong ID")
+	}
+}
@@ -1,321 +1,950 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
 
-type AuthTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"string"`
+// dryRun reports whether DRY_RUN is set, in which case everything up to the output writes
+// runs as usual but nothing is written.
+func dryRun() bool {
+	return os.Getenv("DRY_RUN") == "true"
 }
 
-type Game struct {
-	ID               int    `json:"id"`
-	Name             string `json:"name"`
-	FirstReleaseDate int    `json:"first_release_date"`
-	Franchises       []int  `json:"franchises"`
-	Genres           []int  `json:"genres"`
-	Summary          string `json:"summary"`
-	// DLC            []int  `json:"dlcs"`
-	// MultiplayerModes []int  `json:"multiplayer_modes"`
-	// Ports            []int  `json:"ports"`
-}
+// igdbCredentials reads the IGDB client credentials from the Secrets Manager secret named by
+// IGDB_CREDENTIALS_SECRET_ARN if it is set, and from CLIENT_ID and CLIENT_SECRET otherwise.
+func igdbCredentials(ctx context.Context) (clientID, clientSecret string, err error) {
+	if secretID := os.Getenv("IGDB_CREDENTIALS_SECRET_ARN"); secretID != "" {
+		return secretCredentials(ctx, secretID)
+	}
 
-type Genre struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
+	clientID = os.Getenv("CLIENT_ID")
+	clientSecret = os.Getenv("CLIENT_SECRET")
 
-type Franchise struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Games []int  `json:"games"`
-}
-
-type Cover struct {
-	ID     int    `json:"id"`
-	Game   int    `json:"game"`
-	Height int    `json:"height"`
-	Width  int    `json:"width"`
-	URL    string `json:"url"`
+	if clientID == "" || clientSecret == "" {
+		return "", "", fmt.Errorf("CLIENT_ID or CLIENT_SECRET variables are required but not set")
+	}
+	return clientID, clientSecret, nil
 }
 
-type Fetcher[T Game | Genre | Franchise | Cover] struct {
-	clientID    string
-	accessToken string
-	url         string
-	limiter     *rate.Limiter
-	ctx         context.Context
-	logger      *log.Logger
-}
+// newIGDBClient authenticates with Twitch and returns an IGDB client with the default rate
+// limit. Callers adjust the remaining settings before creating fetchers. When
+// IGDB_TOKEN_PARAMETER names an SSM parameter, the access token is cached there between runs.
+func newIGDBClient(ctx context.Context, logger *log.Entry) (*igdb.Client, error) {
+	limiter, err := newLimiter()
+	if err != nil {
+		return nil, err
+	}
 
-func (f *Fetcher[T]) fetchQuery(query string) ([]T, error) {
-	req, err := http.NewRequest(http.MethodPost, f.url, bytes.NewBuffer([]byte(query)))
+	clientID, clientSecret, err := igdbCredentials(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Client-ID", f.clientID)
-	req.Header.Set("Authorization", "Bearer "+f.accessToken)
-	req.Header.Set("Content-Type", "text/plain")
+	var cache igdb.TokenCache
+	if name := os.Getenv("IGDB_TOKEN_PARAMETER"); name != "" {
+		cache = &ssmTokenCache{ctx: ctx, logger: logger, name: name}
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// IGDB_PROXY_URL overrides the HTTPS_PROXY/HTTP_PROXY environment variables. The token
+	// request shares the client, so it goes through the same proxy as the API requests.
+	var proxy *url.URL
+	if v := os.Getenv("IGDB_PROXY_URL"); v != "" {
+		proxy, err = url.Parse(v)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("Invalid IGDB_PROXY_URL %q: expected a URL such as http://proxy:3128", v)
+		}
+	}
+	timeout, err := requestTimeout()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	httpClient := igdb.NewHTTPClient(proxy, timeout)
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status code %d: %s", resp.StatusCode, string(body))
+	// Both URLs can point at a local mock; empty values use the real endpoints
+	tokens, err := igdb.NewTokenSource(httpClient, os.Getenv("IGDB_AUTH_URL"), clientID, clientSecret, cache)
+	if err != nil {
+		logger.Errorf("Error retrieving authentication token: %v", err)
+		return nil, err
 	}
 
-	var results []T
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
-		return nil, fmt.Errorf("Error decoding API response: %v", err)
-	}
+	return &igdb.Client{
+		HTTP:           httpClient,
+		BaseURL:        os.Getenv("IGDB_BASE_URL"),
+		ClientID:       clientID,
+		Tokens:         tokens,
+		Limiter:        limiter,
+		Logger:         logger,
+		RequestTimeout: timeout,
+	}, nil
+}
 
-	return results, nil
+// requestTimeout reads IGDB_REQUEST_TIMEOUT, how long a single IGDB request attempt may take.
+// Zero, when it isn't set, means igdb.DefaultRequestTimeout.
+func requestTimeout() (time.Duration, error) {
+	v := os.Getenv("IGDB_REQUEST_TIMEOUT")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid IGDB_REQUEST_TIMEOUT %q: must be a positive duration", v)
+	}
+	return d, nil
 }
 
-func (f *Fetcher[T]) fetchAll(query string, numWorkers, pageLimit int) []T {
-	var wg sync.WaitGroup
-	offsetChan := make(chan int, 5)
-	resultChan := make(chan []T)
+// newLimiter returns the limiter every request waits on. IGDB has a request rate limit of
+// 4 req / sec. The adaptive limiter starts right at it and backs off on 429s, while the
+// default stays safely below it. IGDB_RATE (requests per second, the adaptive limiter's
+// ceiling) and IGDB_BURST override the defaults, e.g. for a mock server; rates above IGDB's
+// limit get requests rejected and risk the client ID being banned.
+func newLimiter() (*igdb.BudgetLimiter, error) {
+	adaptive := os.Getenv("ADAPTIVE_RATE_LIMIT") == "true"
+	r := 3.0
+	if adaptive {
+		r = 4
+	}
+	if v := os.Getenv("IGDB_RATE"); v != "" {
+		var err error
+		r, err = strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("Invalid IGDB_RATE %q: must be a positive number of requests per second", v)
+		}
+	}
 
-	var results []T
+	burst := 1
+	if v := os.Getenv("IGDB_BURST"); v != "" {
+		var err error
+		burst, err = strconv.Atoi(v)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("Invalid IGDB_BURST %q: must be a positive integer", v)
+		}
+	}
 
-	for i := range numWorkers {
-		offsetChan <- pageLimit * i
+	if adaptive {
+		return igdb.NewAdaptiveLimiter(rate.Limit(r), rate.Limit(min(0.5, r)), burst), nil
 	}
+	return igdb.NewBudgetLimiter(rate.Limit(r), burst), nil
+}
 
-	for i := range numWorkers {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for offset := range offsetChan {
-				if err := f.limiter.Wait(f.ctx); err != nil {
-					f.logger.Errorf("Error rate limiting requests: %v", err)
-					return
-				}
+// fetchAndStoreData runs a full extraction. Its Result is built from the run summary when it
+// returns, so it is set even when the run fails.
+func fetchAndStoreData(ctx context.Context, logger *log.Entry, runID string, opts runOptions) (res *Result, err error) {
+	summary := newRunSummary(runID)
+	defer func() {
+		summary.finish(err)
+		res = summary.result()
+		logRunSummary(logger, summary)
+		emitMetrics(logger, summary)
+		// The summary is still written when the run was cancelled
+		writeRunSummary(context.WithoutCancel(ctx), logger, summary)
+	}()
 
-				var builder strings.Builder
-				builder.WriteString(query)
-				builder.WriteString(fmt.Sprintf("\nlimit %d;\noffset %d;", pageLimit, offset))
+	// Every file from this run, including its summary, is written under its own prefix so
+	// earlier runs are kept
+	runPrefix := opts.Prefix
+	if runPrefix == "" {
+		runPrefix = os.Getenv("OUTPUT_PREFIX")
+	}
+	if runPrefix == "" {
+		runPrefix = summary.StartedAt.Format(time.RFC3339)
+	}
+	summary.prefix = runPrefix
 
-				res, err := f.fetchQuery(builder.String())
-				if err != nil {
-					f.logger.Errorf("Error fetching results with offset %d: %v\n", offset, err)
-					continue
-				}
+	if err := validateEnv(ctx, len(opts.Fetchers.endpoints()) > 0); err != nil {
+		return nil, err
+	}
 
-				resultChan <- res
+	if dryRun() {
+		logger.Warn("DRY_RUN is set, fetched data will not be written")
+	}
 
-				f.logger.Infof("Queried results at offset %d, worker %d, at time %s\n", offset, i, time.Now().String())
+	numWorkers := 3
+	if v := os.Getenv("IGDB_NUM_WORKERS"); v != "" {
+		numWorkers, err = strconv.Atoi(v)
+		if err != nil || numWorkers < 1 || numWorkers > igdb.MaxWorkers {
+			return nil, fmt.Errorf("Invalid IGDB_NUM_WORKERS %q: must be between 1 and %d", v, igdb.MaxWorkers)
+		}
+	}
 
-				if len(res) < pageLimit {
-					f.logger.Infof("Worker %d finished - received partial results (%d < %d)\n", i, len(res), pageLimit)
-					return
-				}
+	pageLimit := igdb.MaxPageLimit
+	if v := os.Getenv("IGDB_PAGE_LIMIT"); v != "" {
+		pageLimit, err = strconv.Atoi(v)
+		if err != nil || pageLimit < 1 || pageLimit > igdb.MaxPageLimit {
+			return nil, fmt.Errorf("Invalid IGDB_PAGE_LIMIT %q: must be between 1 and %d", v, igdb.MaxPageLimit)
+		}
+	}
+	if opts.PageLimit > 0 {
+		pageLimit = opts.PageLimit
+	}
 
-				offsetChan <- offset + pageLimit*numWorkers
+	// Fixture mode reads every entity from saved files instead of IGDB, so no credentials or
+	// API requests are needed. Neither are they with injected fetchers, and entities without
+	// one then fail rather than reach IGDB.
+	fixtures, err := fixtureDir()
+	if err != nil {
+		return nil, err
+	}
+	opts.fixtures = fixtures
+
+	var client *igdb.Client
+	switch {
+	case fixtures != "":
+		logger.Infof("IGDB_FIXTURE_DIR is set, reading entities from %s instead of IGDB", fixtures)
+		client = &igdb.Client{Limiter: igdb.NewBudgetLimiter(3, 1), Logger: logger}
+	case opts.offline():
+		logger.Infof("Fetchers are injected for %v, running without IGDB", opts.Fetchers.endpoints())
+		client = &igdb.Client{Limiter: igdb.NewBudgetLimiter(3, 1), Logger: logger}
+	default:
+		if client, err = newIGDBClient(ctx, logger); err != nil {
+			return nil, err
+		}
+	}
+	client.Recorder = summary
+
+	if os.Getenv("PREFLIGHT") == "true" && !opts.offline() {
+		// The client already authenticated; the pings confirm the token works and IGDB answers
+		var endpoints []string
+		for _, entity := range eventEntities {
+			if opts.fetches(entity) {
+				endpoints = append(endpoints, entity)
 			}
-		}(i)
+		}
+		if err := preflight(ctx, logger, client, endpoints); err != nil {
+			return nil, err
+		}
+	}
+	if os.Getenv("CHECKPOINT") == "true" {
+		// Keyset fetches save their progress so a run cut short, e.g. by the Lambda timeout,
+		// resumes where it stopped. Saves must still go through once the run is cancelled.
+		client.Checkpoints = &outputCheckpoints{ctx: context.WithoutCancel(ctx)}
 	}
 
-	go func() {
-		wg.Wait()
-		f.logger.Info("All workers finished.")
-		close(offsetChan)
-		close(resultChan)
-	}()
-
-	for r := range resultChan {
-		results = append(results, r...)
+	if os.Getenv("SAVE_RAW_RESPONSES") == "true" {
+		// Keeps every page as IGDB sent it for diagnosing decode problems, roughly doubling storage
+		client.RawResponses = &outputRawStore{ctx: ctx, prefix: runPrefix}
 	}
 
-	return results
-}
+	// Normally a record that doesn't decode fails its page, so schema drift is noticed
+	client.LenientDecode = os.Getenv("LENIENT_DECODE") == "true"
+
+	// Normally a field IGDB no longer knows fails the query; this keeps the run going without it
+	client.DropUnknownFields = os.Getenv("DROP_UNKNOWN_FIELDS") == "true"
 
-func retrieveAuthToken(clientID, clientSecret string) (*AuthTokenResponse, error) {
-	authResp := new(AuthTokenResponse)
-	res, err := http.Post(fmt.Sprintf("https://id.twitch.tv/oauth2/token?client_id=%s&client_secret=%s&grant_type=client_credentials", clientID, clientSecret), "application/json", nil)
+	client.Concurrency, err = igdb.ParseConcurrencyModel(os.Getenv("FETCH_CONCURRENCY"))
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 
-	if err := json.NewDecoder(res.Body).Decode(&authResp); err != nil {
+	client.Retry, err = igdb.LoadRetryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	client.Breaker, err = igdb.LoadBreaker()
+	if err != nil {
 		return nil, err
 	}
 
-	return authResp, nil
-}
+	enrichment, err := loadGameEnrichment()
+	if err != nil {
+		return nil, err
+	}
 
-var s3Client *s3.Client
+	maxFailedPct := 5.0
+	if v := os.Getenv("MAX_FAILED_PAGE_PCT"); v != "" {
+		maxFailedPct, err = strconv.ParseFloat(v, 64)
+		if err != nil || maxFailedPct < 0 || maxFailedPct > 100 {
+			return nil, fmt.Errorf("Invalid MAX_FAILED_PAGE_PCT %q: must be between 0 and 100", v)
+		}
+	}
 
-func init() {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Fatalf("Unable to load SDK config, %v", err)
+	if v := os.Getenv("MAX_RUN_RECORDS"); v != "" {
+		maxRecords, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid MAX_RUN_RECORDS: %v", err)
+		}
+		client.Budget = igdb.NewRecordBudget(maxRecords)
 	}
 
-	s3Client = s3.NewFromConfig(cfg)
-}
+	// MAX_RECORDS samples each entity, e.g. for quick local runs
+	if v := os.Getenv("MAX_RECORDS"); v != "" {
+		client.MaxRecords, err = strconv.Atoi(v)
+		if err != nil || client.MaxRecords < 1 {
+			return nil, fmt.Errorf("Invalid MAX_RECORDS %q: must be a positive integer", v)
+		}
+	}
 
-func uploadToS3(ctx context.Context, key string, data []byte) error {
-	bucketName := os.Getenv("S3_BUCKET")
-	if bucketName == "" {
-		return fmt.Errorf("S3_BUCKET variable is required but not set")
+	var counts *countCheck
+	minCompleteness := os.Getenv("MIN_COMPLETENESS_PCT")
+	if os.Getenv("VERIFY_COUNTS") == "true" || minCompleteness != "" {
+		maxShortfallPct := 1.0
+		if v := os.Getenv("MAX_COUNT_SHORTFALL_PCT"); v != "" {
+			maxShortfallPct, err = strconv.ParseFloat(v, 64)
+			if err != nil || maxShortfallPct < 0 || maxShortfallPct > 100 {
+				return nil, fmt.Errorf("Invalid MAX_COUNT_SHORTFALL_PCT %q: must be between 0 and 100", v)
+			}
+		}
+		if minCompleteness != "" {
+			// MIN_COMPLETENESS_PCT is the same threshold expressed as the share that must arrive
+			if os.Getenv("MAX_COUNT_SHORTFALL_PCT") != "" {
+				return nil, fmt.Errorf("MIN_COMPLETENESS_PCT and MAX_COUNT_SHORTFALL_PCT can't both be set")
+			}
+			minPct, err := strconv.ParseFloat(minCompleteness, 64)
+			if err != nil || minPct < 0 || minPct > 100 {
+				return nil, fmt.Errorf("Invalid MIN_COMPLETENESS_PCT %q: must be between 0 and 100", minCompleteness)
+			}
+			maxShortfallPct = 100 - minPct
+		}
+		if client.Budget != nil || client.MaxRecords > 0 {
+			// Record caps truncate fetches on purpose, so shortfalls would be expected
+			logger.Warn("MAX_RUN_RECORDS or MAX_RECORDS is set, skipping count verification")
+		} else if opts.offline() {
+			logger.Warn("IGDB_FIXTURE_DIR is set or fetchers are injected, skipping count verification")
+		} else {
+			counts = newCountCheck(logger, maxShortfallPct)
+		}
 	}
-	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &key,
-		Body:   bytes.NewReader(data),
-	})
 
+	// A single worker walks offsets in ascending order and the entities are fetched one after
+	// another, so logs and output ordering are reproducible
+	deterministic := os.Getenv("DETERMINISTIC_FETCH") == "true"
+	if deterministic {
+		logger.Info("Deterministic fetch mode enabled, using a single worker and fetching entities in turn")
+		numWorkers = 1
+	}
+
+	// Page failures are collected per entity and checked once every fetch has finished
+	var fetchErrs []error
+
+	// Genres, games and franchises are fetched concurrently. They share client.Limiter, which
+	// stays the single point of throttling, so running them together doesn't exceed IGDB's limit.
+	g, gctx := errgroup.WithContext(ctx)
+	if deterministic {
+		// Each g.Go then waits for the previous fetch to finish
+		g.SetLimit(1)
+	}
+
+	genresFetcher := igdb.NewFetcher[igdb.Genre](gctx, client, "genres")
+	genresQuery := fieldsQuery("genres")
+
+	gamesFetcher := igdb.NewFetcher[igdb.Game](gctx, client, "games")
+	// The games catalog is larger than IGDB's offset cap, so it pages by ID unless overridden
+	gamesFetcher.Pagination, err = igdb.ParsePagination(os.Getenv("GAMES_PAGINATION"), igdb.PaginationKeyset)
 	if err != nil {
-		return fmt.Errorf("Failed to upload data to S3: %v", err)
+		return nil, fmt.Errorf("Invalid GAMES_PAGINATION: %v", err)
+	}
+	gamesKey := "games.json"
+	// IGDB accepts a single where clause, so filters are collected and joined with &
+	var gamesFilters []string
+
+	// since is the updated_at boundary of an incremental run, 0 for a full fetch
+	var since int64
+	if os.Getenv("INCREMENTAL") == "true" {
+		if since = incrementalBoundary(ctx); since > 0 {
+			logger.Infof("Incremental run, fetching games updated since %d", since)
+			gamesFilters = append(gamesFilters, fmt.Sprintf("updated_at > %d", since))
+			gamesKey = "games_delta.json"
+		} else {
+			logger.Warn("No completed previous manifest found, falling back to a full fetch")
+		}
 	}
 
-	return nil
-}
+	// A backfill re-fetches a known slice of the catalog by offset, e.g. to patch a gap, and
+	// writes it to its own key instead of replacing the games file
+	offsetStart, offsetEnd, backfill, err := offsetRange()
+	if err != nil {
+		return nil, err
+	}
+	if backfill {
+		logger.Infof("Backfill run, fetching games at offsets %d to %d", offsetStart, offsetEnd)
+		gamesFetcher.Pagination = igdb.PaginationOffset
+		gamesFetcher.OffsetStart, gamesFetcher.OffsetEnd = offsetStart, offsetEnd
+		gamesKey = backfillKey(offsetStart, offsetEnd)
+		if counts != nil {
+			// Only a slice of the games is fetched, so the catalog count can't match
+			logger.Warn("FETCH_OFFSET_START/END is set, skipping count verification")
+			counts = nil
+		}
+	}
 
-func fetchAndStoreData(ctx context.Context, logger *log.Logger) error {
+	var allowedGenres []int
+	if allowed := os.Getenv("ALLOWED_GENRES"); allowed != "" {
+		allowedGenres, err = parseIDs([]string{allowed})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ALLOWED_GENRES: %v", err)
+		}
+		logger.Infof("Restricting games to genres %v", allowedGenres)
+		gamesFilters = append(gamesFilters, fmt.Sprintf("genres = (%s)", idList(allowedGenres)))
+	}
 
-	clientID := os.Getenv("CLIENT_ID")
-	clientSecret := os.Getenv("CLIENT_SECRET")
+	if v := os.Getenv("MIN_RATING"); v != "" {
+		minRating, err := strconv.ParseFloat(v, 64)
+		if err != nil || minRating < 0 || minRating > 100 {
+			return nil, fmt.Errorf("Invalid MIN_RATING %q: must be between 0 and 100", v)
+		}
+		// Unrated games have no rating field, so the filter excludes them too
+		logger.Infof("Restricting games to a rating of at least %g", minRating)
+		gamesFilters = append(gamesFilters, fmt.Sprintf("rating >= %g", minRating))
+	}
 
-	if clientID == "" || clientSecret == "" {
-		return fmt.Errorf("CLIENT_ID or CLIENT_SECRET variables are required but not set")
+	gamesQuery := fieldsQuery("games")
+	if len(gamesFilters) > 0 {
+		gamesQuery += fmt.Sprintf("\nwhere %s;", strings.Join(gamesFilters, " & "))
 	}
 
-	authResp, err := retrieveAuthToken(clientID, clientSecret)
+	// Streaming writes games straight to the output as NDJSON page by page, so memory stays bounded but
+	// the whole-file games output and game enrichment are skipped
+	streamGames := os.Getenv("STREAM_OUTPUT") == "true"
+	outputMode, err := parseOutputMode(os.Getenv("OUTPUT_MODE"))
 	if err != nil {
-		logger.Errorf("Error retrieving authentication token: %v", err)
-		return err
+		return nil, err
+	}
+	if outputMode == outputModeCombined && streamGames {
+		return nil, fmt.Errorf("OUTPUT_MODE=combined can't be used with STREAM_OUTPUT, which never holds the games in memory")
+	}
+	outputFormat, err := parseOutputFormat(os.Getenv("OUTPUT_FORMAT"))
+	if err != nil {
+		return nil, err
+	}
+	if outputMode == outputModeCombined && opts.partial() {
+		return nil, fmt.Errorf("OUTPUT_MODE=combined writes every entity and can't be used with an entities override")
 	}
+	if outputMode == outputModeCombined && outputFormat == outputFormatNDJSON {
+		return nil, fmt.Errorf("OUTPUT_MODE=combined writes a single object and can't use OUTPUT_FORMAT=ndjson")
+	}
+	streamFile := strings.TrimSuffix(gamesKey, ".json") + ".ndjson"
 
-	// IGDB has a request rate limit of 4 req / sec
-	limiter := rate.NewLimiter(3, 1)
-	numWorkers := 3
-	pageLimit := 500
+	// Multiquery fetches a page of genres, games and franchises in each request. It holds
+	// every result in memory and isn't metered by the record budget.
+	useMultiquery := os.Getenv("MULTIQUERY") == "true"
+	if opts.offline() && (useMultiquery || streamGames) {
+		return nil, fmt.Errorf("IGDB_FIXTURE_DIR and injected fetchers can't be used with MULTIQUERY or STREAM_OUTPUT")
+	}
+	if useMultiquery && (streamGames || client.Budget != nil || client.MaxRecords > 0 || backfill || opts.partial()) {
+		return nil, fmt.Errorf("MULTIQUERY can't be used with STREAM_OUTPUT, MAX_RUN_RECORDS, MAX_RECORDS, FETCH_OFFSET_START/END or an entities override")
+	}
+
+	franchisesFetcher := igdb.NewFetcher[igdb.Franchise](gctx, client, "franchises")
+	franchisesQuery := fieldsQuery("franchises")
+
+	var (
+		genres     []igdb.Genre
+		games      []igdb.Game
+		franchises []igdb.Franchise
+		// streamedGames counts games written by STREAM_OUTPUT, which aren't kept in games
+		streamedGames int
+
+		genresErr, gamesErr, franchisesErr error
+	)
+
+	if useMultiquery {
+		g.Go(func() error {
+			expectCount(counts, genresFetcher, genresQuery)
+			expectCount(counts, gamesFetcher, gamesQuery)
+			expectCount(counts, franchisesFetcher, franchisesQuery)
+			logger.Info("Fetching genres, games and franchises data with multiquery...")
+
+			start := time.Now()
+			results, err := client.FetchMulti(gctx, []igdb.MultiQuery{
+				{Name: "genres", Endpoint: "genres", Query: genresQuery},
+				{Name: "games", Endpoint: "games", Query: gamesQuery},
+				{Name: "franchises", Endpoint: "franchises", Query: franchisesQuery},
+			}, pageLimit)
+			if err != nil {
+				return err
+			}
+			elapsed := time.Since(start)
+
+			genres, genresErr = igdb.DecodeMulti[igdb.Genre](results["genres"])
+			games, gamesErr = igdb.DecodeMulti[igdb.Game](results["games"])
+			franchises, franchisesErr = igdb.DecodeMulti[igdb.Franchise](results["franchises"])
+			summary.RecordFetch("genres", len(genres), failedPages(genresErr), false, elapsed, genresErr)
+			summary.RecordFetch("games", len(games), failedPages(gamesErr), false, elapsed, gamesErr)
+			summary.RecordFetch("franchises", len(franchises), failedPages(franchisesErr), false, elapsed, franchisesErr)
+			return nil
+		})
+	} else {
+		g.Go(func() error {
+			if !opts.fetches("genres") {
+				return nil
+			}
+			expectCount(counts, genresFetcher, genresQuery)
+			logger.Info("Fetching genres data...")
+			genres, genresErr = pageFetcher(opts, client, genresFetcher).FetchAll(genresQuery, numWorkers, pageLimit)
+			return nil
+		})
+
+		g.Go(func() error {
+			if !opts.fetches("games") {
+				return nil
+			}
+			expectCount(counts, gamesFetcher, gamesQuery)
+			if !streamGames {
+				// Summaries are embedded from each page as it arrives, overlapping the fetch,
+				// and the embedding is waited for before the games are enriched
+				onPage, embedded := enrichment.embedFetchedPages(gctx, logger)
+				gamesFetcher.OnPage = onPage
+
+				logger.Info("Fetching games data...")
+				games, gamesErr = pageFetcher(opts, client, gamesFetcher).FetchAll(gamesQuery, numWorkers, pageLimit)
+				if embedded != nil {
+					embedded()
+				}
+				return nil
+			}
+
+			streamKey := path.Join(runPrefix, streamFile)
+			logger.Infof("Streaming games data to %s...", streamKey)
+			count, err := streamOutput(gctx, gamesFetcher, streamKey, gamesQuery, numWorkers, pageLimit)
+			var fetchErr *igdb.FetchError
+			if err != nil && !errors.As(err, &fetchErr) {
+				return err
+			}
+			gamesErr = err
+			streamedGames = count
+			if dryRun() {
+				logger.Infof("Dry run, skipped streaming %d games to %s", count, streamKey)
+			} else {
+				logger.Infof("Streamed %d games to %s", count, streamKey)
+			}
+			return nil
+		})
+
+		g.Go(func() error {
+			if !opts.fetches("franchises") {
+				return nil
+			}
+			expectCount(counts, franchisesFetcher, franchisesQuery)
+			logger.Info("Fetching franchises data...")
+			franchises, franchisesErr = pageFetcher(opts, client, franchisesFetcher).FetchAll(franchisesQuery, numWorkers, pageLimit)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	fetchErrs = append(fetchErrs, genresErr, gamesErr, franchisesErr)
+
+	if err := errors.Join(
+		counts.verify(genresFetcher.Entity(), len(genres)),
+		counts.verify(gamesFetcher.Entity(), len(games)+streamedGames),
+		counts.verify(franchisesFetcher.Entity(), len(franchises)),
+	); err != nil {
+		return nil, err
+	}
 
-	genresFetcher := Fetcher[Genre]{
-		clientID:    clientID,
-		accessToken: authResp.AccessToken,
-		url:         "https://api.igdb.com/v4/genres",
-		limiter:     limiter,
-		ctx:         ctx,
-		logger:      logger,
+	if allowedGenres != nil && opts.fetches("genres") {
+		// Checked once genres are in, since they're fetched alongside the games they filter
+		if err := validateGenreIDs(allowedGenres, genres); err != nil {
+			return nil, err
+		}
 	}
-	genresQuery := "fields id, name;"
 
-	logger.Info("Fetching genres data...")
-	genres := genresFetcher.fetchAll(genresQuery, numWorkers, pageLimit)
+	var themes []igdb.Theme
+	if opts.fetches("themes") {
+		themesFetcher := igdb.NewFetcher[igdb.Theme](ctx, client, "themes")
+		themesQuery := fieldsQuery("themes")
 
-	gamesFetcher := Fetcher[Game]{
-		clientID:    clientID,
-		accessToken: authResp.AccessToken,
-		url:         "https://api.igdb.com/v4/games",
-		limiter:     limiter,
-		ctx:         ctx,
-		logger:      logger,
+		logger.Info("Fetching themes data...")
+		themes, err = pageFetcher(opts, client, themesFetcher).FetchAll(themesQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
 	}
-	gamesQuery := "fields id, name, first_release_date, dlcs, franchises, genres, multiplayer_modes, ports, summary;"
 
-	logger.Info("Fetching games data...")
-	games := gamesFetcher.fetchAll(gamesQuery, numWorkers, pageLimit)
+	var covers []igdb.Cover
+	if opts.fetches("covers") {
+		// There's a cover per game, far past IGDB's offset cap, so covers page by ID
+		coversFetcher := igdb.NewFetcher[igdb.Cover](ctx, client, "covers")
+		coversFetcher.Pagination = igdb.PaginationKeyset
+		coversQuery := fieldsQuery("covers")
+
+		logger.Info("Fetching covers data...")
+		covers, err = pageFetcher(opts, client, coversFetcher).FetchAll(coversQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+		attachCoverURLs(games, covers)
+	} else if opts.fetches("games") {
+		// A games run restricted by its event only needs the covers of the games it fetched,
+		// not the whole catalog's, and doesn't write them out
+		logger.Info("Fetching covers of the fetched games...")
+		referenced, err := fetchWhere[igdb.Cover](ctx, opts, client, "covers", "id", coverIDs(games))
+		fetchErrs = append(fetchErrs, err)
+		attachCoverURLs(games, referenced)
+	}
 
-	franchisesFetcher := Fetcher[Franchise]{
-		clientID:    clientID,
-		accessToken: authResp.AccessToken,
-		url:         "https://api.igdb.com/v4/franchises",
-		limiter:     limiter,
-		ctx:         ctx,
-		logger:      logger,
+	var platforms []igdb.Platform
+	if opts.fetches("platforms") {
+		platformsFetcher := igdb.NewFetcher[igdb.Platform](ctx, client, "platforms")
+		platformsQuery := fieldsQuery("platforms")
+
+		logger.Info("Fetching platforms data...")
+		platforms, err = pageFetcher(opts, client, platformsFetcher).FetchAll(platformsQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
 	}
-	franchisesQuery := "fields id, name, games;"
 
-	logger.Info("Fetching franchises data...")
-	franchises := franchisesFetcher.fetchAll(franchisesQuery, numWorkers, pageLimit)
+	// The remaining entities only enrich games, so they're skipped when games aren't fetched
+	fetchGames := opts.fetches("games")
+
+	if fetchGames && os.Getenv("FETCH_EXTERNAL_GAMES") == "true" {
+		// Both this and game_localizations are far larger than IGDB's offset cap, so they page by ID
+		externalGamesFetcher := igdb.NewFetcher[igdb.ExternalGame](ctx, client, "external_games")
+		externalGamesFetcher.Pagination = igdb.PaginationKeyset
+		externalGamesQuery := fieldsQuery("external_games")
+
+		logger.Info("Fetching external games data...")
+		externalGames, err := pageFetcher(opts, client, externalGamesFetcher).FetchAll(externalGamesQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
 
-	coversFetcher := Fetcher[Cover]{
-		clientID:    clientID,
-		accessToken: authResp.AccessToken,
-		url:         "https://api.igdb.com/v4/covers",
-		limiter:     limiter,
-		ctx:         ctx,
-		logger:      logger,
+		attachStoreLinks(games, externalGames)
 	}
-	coversQuery := "fields id, game, height, width, url;"
 
-	logger.Info("Fetching covers data...")
-	covers := coversFetcher.fetchAll(coversQuery, numWorkers, pageLimit)
+	if fetchGames && os.Getenv("FETCH_LOCALIZATIONS") == "true" {
+		regionsFetcher := igdb.NewFetcher[igdb.Region](ctx, client, "regions")
+		regionsQuery := fieldsQuery("regions")
 
-	fileMap := map[string]any{
-		"games.json":      games,
-		"genres.json":     genres,
-		"franchises.json": franchises,
-		"covers.json":     covers,
+		logger.Info("Fetching regions data...")
+		regions, err := pageFetcher(opts, client, regionsFetcher).FetchAll(regionsQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+
+		localizationsFetcher := igdb.NewFetcher[igdb.GameLocalization](ctx, client, "game_localizations")
+		localizationsFetcher.Pagination = igdb.PaginationKeyset
+		localizationsQuery := fieldsQuery("game_localizations")
+
+		logger.Info("Fetching game localizations data...")
+		localizations, err := pageFetcher(opts, client, localizationsFetcher).FetchAll(localizationsQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+
+		attachLocalizedTitles(games, localizations, regions)
 	}
 
-	for filename, value := range fileMap {
-		data, err := json.MarshalIndent(value, "", "  ")
+	if fetchGames && os.Getenv("FETCH_ALTERNATIVE_NAMES") == "true" {
+		altNamesFetcher := igdb.NewFetcher[igdb.AlternativeName](ctx, client, "alternative_names")
+		// The endpoint is larger than IGDB's offset cap, so it pages by ID
+		altNamesFetcher.Pagination = igdb.PaginationKeyset
+		altNamesQuery := fieldsQuery("alternative_names")
+
+		logger.Info("Fetching alternative names data...")
+		altNames, err := pageFetcher(opts, client, altNamesFetcher).FetchAll(altNamesQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+
+		attachAltNames(games, altNames)
+	}
+
+	// Developer and publisher credits live on involved_companies, a join between games and
+	// companies, so both are fetched and resolved onto the games
+	var companies []igdb.Company
+	if fetchGames && os.Getenv("FETCH_COMPANIES") == "true" {
+		// Both endpoints are larger than IGDB's offset cap, so they page by ID
+		companiesFetcher := igdb.NewFetcher[igdb.Company](ctx, client, "companies")
+		companiesFetcher.Pagination = igdb.PaginationKeyset
+		companiesQuery := fieldsQuery("companies")
+
+		logger.Info("Fetching companies data...")
+		companies, err = pageFetcher(opts, client, companiesFetcher).FetchAll(companiesQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+
+		involvedFetcher := igdb.NewFetcher[igdb.InvolvedCompany](ctx, client, "involved_companies")
+		involvedFetcher.Pagination = igdb.PaginationKeyset
+		involvedQuery := fieldsQuery("involved_companies")
+
+		logger.Info("Fetching involved companies data...")
+		involved, err := pageFetcher(opts, client, involvedFetcher).FetchAll(involvedQuery, numWorkers, pageLimit)
+		fetchErrs = append(fetchErrs, err)
+
+		attachCompanies(games, involved, companies)
+	}
+
+	// Once the breaker trips every remaining request fails, so the run stops here whatever
+	// share of pages got through
+	if err := client.Breaker.Err(); err != nil {
+		return nil, fmt.Errorf("Aborting run, IGDB appears to be unavailable: %w", err)
+	}
+	if err := checkFetchErrors(logger, fetchErrs, maxFailedPct); err != nil {
+		return nil, err
+	}
+
+	// Pages arrive in completion order, so records are sorted by ID unless SORT_OUTPUT=false.
+	// Streamed games are written as they arrive and stay unsorted.
+	if os.Getenv("SORT_OUTPUT") != "false" {
+		sortByID(genres)
+		sortByID(themes)
+		sortByID(games)
+		sortByID(franchises)
+		sortByID(covers)
+		sortByID(platforms)
+		sortByID(companies)
+	}
+
+	games = enrichment.apply(ctx, logger, games, newNameLookups(genres, themes, franchises))
+
+	var undatedGames []igdb.Game
+	if os.Getenv("SORT_BY_RELEASE_DATE") == "true" {
+		policy, err := parseUndatedPolicy(os.Getenv("UNDATED_GAMES_POLICY"))
 		if err != nil {
-			logger.Errorf("Error marshaling JSON for %s: %v", filename, err)
-			continue
+			return nil, err
 		}
+		games, undatedGames = sortByReleaseDate(games, policy)
+	}
 
-		if err := uploadToS3(ctx, filename, data); err != nil {
-			logger.Errorf("Error uploading %s to S3: %v", filename, err)
+	fileMap := map[string]any{}
+	if opts.fetches("covers") {
+		fileMap["covers.json"] = covers
+	}
+	if opts.fetches("platforms") {
+		fileMap["platforms.json"] = platforms
+	}
+	if companies != nil {
+		fileMap["companies.json"] = companies
+	}
+	if outputMode == outputModeCombined {
+		datasetKey := "dataset.json"
+		if gamesKey != "games.json" {
+			datasetKey = "dataset_delta.json"
+		}
+		fileMap[datasetKey] = Dataset{Games: games, Genres: genres, Themes: themes, Franchises: franchises}
+	} else {
+		if opts.fetches("genres") {
+			fileMap["genres.json"] = genres
+		}
+		if opts.fetches("themes") {
+			fileMap["themes.json"] = themes
+		}
+		if opts.fetches("franchises") {
+			fileMap["franchises.json"] = franchises
 		}
+		if fetchGames && !streamGames {
+			fileMap[gamesKey] = games
+		}
+	}
+	if undatedGames != nil {
+		fileMap["games_undated.json"] = undatedGames
 	}
 
-	return nil
+	// Compressed files keep their .json name in the manifest but are written as .json.gz
+	compressOutput := os.Getenv("COMPRESS_OUTPUT") == "true"
+
+	manifest := &Manifest{
+		RunID:         runID,
+		HighWaterMark: highWaterMark(games, since),
+		RunPrefix:     runPrefix,
+		SummaryKey:    path.Join(runPrefix, runSummaryKey),
+		Keys:          make(map[string]string, len(fileMap)+1),
+		Records:       make(map[string]int, len(fileMap)+1),
+		Checksums:     make(map[string]string, len(fileMap)),
+		IGDBCounts:    counts.expectedCounts(),
+		StartedAt:     summary.StartedAt,
+		Incremental:   since > 0,
+		Backfill:      backfill,
+		Capped:        client.Budget != nil || client.MaxRecords > 0,
+		Entities:      opts.Entities,
+	}
+	if streamGames {
+		manifest.Keys[streamFile] = path.Join(runPrefix, streamFile)
+		manifest.Records[streamFile] = streamedGames
+	}
 
+	// Files are uploaded concurrently and any failure fails the run, so it never reports
+	// success with a file missing
+	var uploads errgroup.Group
+	var manifestMu sync.Mutex
+	for filename, value := range fileMap {
+		filename := outputFileName(filename, outputFormat)
+		uploads.Go(func() error {
+			data, err := encodeOutput(value, outputFormat)
+			if err != nil {
+				return fmt.Errorf("Error marshaling JSON for %s: %v", filename, err)
+			}
+
+			key := path.Join(runPrefix, filename)
+			if compressOutput {
+				key += ".gz"
+			}
+			if dryRun() {
+				logger.Infof("Dry run, skipping upload of %s (%d records, %d bytes)", key, recordCount(value), len(data))
+			}
+			sum, err := writeOutputChecksum(ctx, key, data)
+			summary.recordUpload(key, len(data), err)
+			if err != nil {
+				return fmt.Errorf("Error writing %s: %w", key, err)
+			}
+
+			manifestMu.Lock()
+			defer manifestMu.Unlock()
+			manifest.Keys[filename] = key
+			manifest.Records[filename] = recordCount(value)
+			manifest.Checksums[filename] = sum
+			return nil
+		})
+	}
+	uploadErr := uploads.Wait()
+	manifest.Complete = uploadErr == nil
+
+	fetched := summary.result()
+	manifest.EntityRecords, manifest.FailedPages = fetched.Records, fetched.FailedPages
+
+	completedAt := time.Now()
+	manifest.CompletedAt = completedAt.Unix()
+	manifest.Duration = completedAt.Sub(summary.StartedAt).String()
+
+	if dryRun() {
+		logger.Info("Dry run, skipping manifest upload")
+	}
+	if err := writeManifest(ctx, manifest); err != nil {
+		logger.Errorf("Error writing manifest: %v", err)
+	}
+
+	return nil, uploadErr
+}
+
+// Event is the optional Lambda invocation payload.
+type Event struct {
+	RefetchIDs []int `json:"refetch_ids"`
+	// IdempotencyKey names the run. A repeated key returns the completed run's result instead
+	// of extracting again, unless Force is set.
+	IdempotencyKey string `json:"idempotency_key"`
+	Force          bool   `json:"force"`
+	// Entities, PageLimit and OutputPrefix override the run's defaults, e.g. to refresh only
+	// the genres.
+	Entities     []string `json:"entities"`
+	PageLimit    int      `json:"page_limit"`
+	OutputPrefix string   `json:"output_prefix"`
 }
 
-func handleRequest(ctx context.Context, event json.RawMessage) error {
+// newRunLogger returns a JSON logger at LOG_LEVEL, defaulting to info, whose entries all
+// carry a new run ID so the lines of overlapping runs can be told apart.
+func newRunLogger() (*log.Entry, string) {
 	logger := log.New()
 	logger.SetFormatter(&log.JSONFormatter{})
+	runID := uuid.NewString()
+	entry := logger.WithField("run_id", runID)
+
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		level, err := log.ParseLevel(v)
+		if err != nil {
+			entry.Warnf("Invalid LOG_LEVEL %q, using info: %v", v, err)
+		} else {
+			logger.SetLevel(level)
+		}
+	}
+	return entry, runID
+}
+
+// handleRequest runs an extraction, or a refetch when the event lists refetch_ids, and
+// returns a Result describing it. Hard failures are returned as the error.
+func handleRequest(ctx context.Context, event json.RawMessage) (*Result, error) {
+	logger, runID := newRunLogger()
+
+	evt, err := decodeEvent(logger, event)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(evt.RefetchIDs) > 0 {
+		report, err := refetchGames(ctx, logger, evt.RefetchIDs)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{RunID: runID, Refetch: report}, nil
+	}
 
-	if err := fetchAndStoreData(ctx, logger); err != nil {
-		return err
+	opts, err := eventOptions(logger, evt)
+	if err != nil {
+		return nil, err
+	}
+	if evt.IdempotencyKey != "" {
+		// The key names the run's prefix, so a repeat finds the first run's manifest
+		prefix, err := keyPrefix("idempotency_key", evt.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if evt.OutputPrefix != "" {
+			return nil, fmt.Errorf("idempotency_key and output_prefix can't both be set")
+		}
+		window, err := idempotencyWindow()
+		if err != nil {
+			return nil, err
+		}
+		if evt.Force {
+			logger.Infof("force is set, running %s again even if it already completed", prefix)
+		} else if res := completedRun(ctx, logger, prefix, window); res != nil {
+			return res, nil
+		}
+		opts.Prefix = prefix
 	}
-	return nil
 
+	return fetchAndStoreData(ctx, logger, runID, opts)
 }
 
 func main() {
-	ctx := context.Background()
-
 	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
 		lambda.Start(handleRequest)
 		return
 	}
 
-	logger := log.New()
-	logger.SetFormatter(&log.JSONFormatter{})
+	// An interrupt cancels the run: workers stop, the failed fetches skip the uploads and any
+	// in-progress streamed upload is aborted, so no partial files are left behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	configFile := flag.String("config", "", "YAML config file overriding the environment")
+	outDir := flag.String("out", "", "write output files to this directory instead of S3, like OUTPUT_TARGET=file with OUTPUT_DIR")
+	pretty := flag.Bool("pretty", false, "indent JSON output, like PRETTY_OUTPUT=true")
+	compact := flag.Bool("compact", false, "write compact JSON output, like PRETTY_OUTPUT=false")
+	flag.Parse()
+
+	logger, runID := newRunLogger()
+
+	if *configFile != "" {
+		cfg, err := loadConfigFile(*configFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.apply()
+	}
+	if *outDir != "" {
+		os.Setenv("OUTPUT_TARGET", outputTargetFile)
+		os.Setenv("OUTPUT_DIR", *outDir)
+	}
+	switch {
+	case *pretty && *compact:
+		logger.Fatal("-pretty and -compact can't both be set")
+	case *pretty:
+		os.Setenv("PRETTY_OUTPUT", "true")
+	case *compact:
+		os.Setenv("PRETTY_OUTPUT", "false")
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "refetch" {
+		ids, err := parseIDs(args[1:])
+		if err != nil {
+			logger.Fatalf("Usage: %s refetch <id>[,<id>...]: %v", os.Args[0], err)
+		}
+		if _, err := refetchGames(ctx, logger, ids); err != nil {
+			logger.Fatalf("Error refetching games: %v", err)
+		}
+		return
+	}
 
-	if err := fetchAndStoreData(ctx, logger); err != nil {
+	if _, err := fetchAndStoreData(ctx, logger, runID, runOptions{}); err != nil {
 		logger.Fatalf("Error executing data fetch: %v", err)
 	}
 }
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// manifestKey is the latest run's manifest. Each run also keeps a copy under its own prefix,
+// so rolling back means copying an older run's manifest over this one.
+const manifestKey = "manifest.json"
+
+// Manifest records the outcome of a completed extraction run.
+type Manifest struct {
+	// RunID matches the run_id field on the run's log lines.
+	RunID    string `json:"run_id"`
+	Complete bool   `json:"complete"`
+	// CompletedAt is the Unix time the run finished writing its files.
+	CompletedAt int64 `json:"completed_at"`
+	// HighWaterMark is the latest updated_at among the games the run fetched, carried over
+	// from the previous run when none were fetched.
+	HighWaterMark int64 `json:"high_water_mark"`
+	// RunPrefix is the key prefix the run's files were written under.
+	RunPrefix string `json:"run_prefix"`
+	// SummaryKey is the key of the run's summary, which is written even when the run fails.
+	SummaryKey string `json:"summary_key"`
+	// Keys maps each output file name, e.g. games.json, to the key it was written to.
+	Keys map[string]string `json:"keys"`
+	// Records maps each output file name to the number of records written to it.
+	Records map[string]int `json:"records"`
+	// EntityRecords and FailedPages map each fetched entity to the records fetched and the
+	// pages that still failed after retries, as in the run's Result.
+	EntityRecords map[string]int `json:"entity_records"`
+	FailedPages   map[string]int `json:"failed_pages"`
+	// Checksums maps each output file name to the base64 SHA-256 of the file as stored,
+	// which S3 verified on upload.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// IGDBCounts maps each entity to the total IGDB's /count endpoint reported before the
+	// fetch, when VERIFY_COUNTS or MIN_COMPLETENESS_PCT is set.
+	IGDBCounts map[string]int `json:"igdb_counts,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	Duration   string         `json:"duration"`
+	// Incremental marks a run that only fetched the games updated since the previous run.
+	Incremental bool `json:"incremental,omitempty"`
+	// Backfill marks a run that only fetched a FETCH_OFFSET_START/END slice of the games.
+	Backfill bool `json:"backfill,omitempty"`
+	// Capped marks a run whose fetch was cut short by MAX_RUN_RECORDS or sampled by MAX_RECORDS.
+	Capped bool `json:"capped,omitempty"`
+	// Entities lists the entities fetched by a run restricted by its event, empty for a full run.
+	Entities []string `json:"entities,omitempty"`
+	// MergedRuns lists the entity-restricted and incremental runs whose files were merged into
+	// this run's in the latest manifest, oldest first.
+	MergedRuns []string `json:"merged_runs,omitempty"`
+}
+
+func readManifest(ctx context.Context, key string) (*Manifest, error) {
+	data, err := readOutput(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := new(Manifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Error decoding manifest: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// writeManifest uploads the manifest under the run's prefix. Only complete runs replace the
+// latest manifest, so readers never get pointed at a run with missing files, and backfills and
+// capped runs never do since they only hold part of the data. The files of an entity-restricted
+// or incremental run are merged into the latest manifest instead.
+func writeManifest(ctx context.Context, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error marshaling manifest: %v", err)
+	}
+
+	if err := writeOutput(ctx, path.Join(manifest.RunPrefix, manifestKey), data); err != nil {
+		return err
+	}
+	if !manifest.Complete || manifest.Backfill || manifest.Capped {
+		return nil
+	}
+	if len(manifest.Entities) > 0 || manifest.Incremental {
+		latest, err := readManifest(ctx, manifestKey)
+		if err != nil || !latest.Complete {
+			// Without a complete run to merge into, the run's files can't stand in for the
+			// whole dataset
+			return nil
+		}
+		manifest = mergeManifest(latest, manifest)
+		if data, err = json.MarshalIndent(manifest, "", "  "); err != nil {
+			return fmt.Errorf("Error marshaling manifest: %v", err)
+		}
+	}
+	return writeOutput(ctx, manifestKey, data)
+}
+
+// mergeManifest returns latest with the files of an entity-restricted or incremental run
+// replacing its own. An incremental run's games_delta.json is added next to the full
+// games.json, and a combined dataset, which only holds what the run fetched, is left out.
+func mergeManifest(latest, run *Manifest) *Manifest {
+	merged := *latest
+	merged.Keys = maps.Clone(latest.Keys)
+	merged.Records = maps.Clone(latest.Records)
+	merged.Checksums = maps.Clone(latest.Checksums)
+	merged.IGDBCounts = maps.Clone(latest.IGDBCounts)
+	merged.EntityRecords = maps.Clone(latest.EntityRecords)
+	merged.FailedPages = maps.Clone(latest.FailedPages)
+	merged.MergedRuns = append(slices.Clip(latest.MergedRuns), run.RunID)
+
+	for filename, key := range run.Keys {
+		if strings.HasPrefix(filename, "dataset") {
+			continue
+		}
+		if merged.Keys == nil {
+			merged.Keys, merged.Records = make(map[string]string), make(map[string]int)
+		}
+		merged.Keys[filename] = key
+		merged.Records[filename] = run.Records[filename]
+		if sum, ok := run.Checksums[filename]; ok {
+			if merged.Checksums == nil {
+				merged.Checksums = make(map[string]string)
+			}
+			merged.Checksums[filename] = sum
+		} else {
+			delete(merged.Checksums, filename)
+		}
+	}
+	for entity, count := range run.IGDBCounts {
+		if merged.IGDBCounts == nil {
+			merged.IGDBCounts = make(map[string]int)
+		}
+		merged.IGDBCounts[entity] = count
+	}
+	for entity, count := range run.EntityRecords {
+		if len(run.Entities) > 0 && !slices.Contains(run.Entities, entity) {
+			// e.g. the covers a games run fetched for its own games
+			continue
+		}
+		if merged.EntityRecords == nil {
+			merged.EntityRecords, merged.FailedPages = make(map[string]int), make(map[string]int)
+		}
+		merged.EntityRecords[entity] = count
+		merged.FailedPages[entity] = run.FailedPages[entity]
+	}
+	if len(run.Entities) == 0 || slices.Contains(run.Entities, "games") {
+		merged.HighWaterMark = max(merged.HighWaterMark, run.HighWaterMark)
+	}
+	return &merged
+}
+
+// incrementalBoundary returns the updated_at boundary for an incremental run, the previous
+// run's high-water mark. It returns 0, meaning a full fetch, when the previous manifest is
+// missing, unreadable or not marked complete.
+func incrementalBoundary(ctx context.Context) int64 {
+	manifest, err := readManifest(ctx, manifestKey)
+	if err != nil || !manifest.Complete {
+		return 0
+	}
+	return manifest.HighWaterMark
+}
+
+// highWaterMark returns the latest updated_at among games, or since if none is later.
+func highWaterMark(games []igdb.Game, since int64) int64 {
+	mark := since
+	for _, g := range games {
+		mark = max(mark, g.UpdatedAt)
+	}
+	return mark
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriteManifestMergesEntityRestrictedRun(t *testing.T) {
+	t.Setenv("OUTPUT_TARGET", "file")
+	t.Setenv("OUTPUT_DIR", t.TempDir())
+	ctx := context.Background()
+
+	full := &Manifest{
+		RunID: "full", Complete: true, RunPrefix: "full", HighWaterMark: 100,
+		Keys:      map[string]string{"games.json": "full/games.json", "genres.json": "full/genres.json"},
+		Records:   map[string]int{"games.json": 10, "genres.json": 5},
+		Checksums: map[string]string{"games.json": "g1", "genres.json": "n1"},
+	}
+	if err := writeManifest(ctx, full); err != nil {
+		t.Fatal(err)
+	}
+	genresOnly := &Manifest{
+		RunID: "genres", Complete: true, RunPrefix: "genres", HighWaterMark: 200, Entities: []string{"genres"},
+		Keys:      map[string]string{"genres.json": "genres/genres.json"},
+		Records:   map[string]int{"genres.json": 6},
+		Checksums: map[string]string{"genres.json": "n2"},
+	}
+	if err := writeManifest(ctx, genresOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := readManifest(ctx, manifestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Keys["genres.json"] != "genres/genres.json" || latest.Records["genres.json"] != 6 || latest.Checksums["genres.json"] != "n2" {
+		t.Errorf("genres weren't merged into the latest manifest: %+v", latest)
+	}
+	if latest.Keys["games.json"] != "full/games.json" || latest.Records["games.json"] != 10 {
+		t.Errorf("games of the full run were lost: %+v", latest)
+	}
+	if latest.RunID != "full" || len(latest.MergedRuns) != 1 || latest.MergedRuns[0] != "genres" {
+		t.Errorf("run ID %q, merged runs %v, want full merged with genres", latest.RunID, latest.MergedRuns)
+	}
+	if latest.HighWaterMark != 100 {
+		t.Errorf("high-water mark = %d, want 100 since the merged run didn't fetch games", latest.HighWaterMark)
+	}
+	if full.Keys["genres.json"] != "full/genres.json" {
+		t.Error("merging modified the full run's manifest")
+	}
+}
+
+func TestWriteManifestRestrictedRunWithoutLatest(t *testing.T) {
+	t.Setenv("OUTPUT_TARGET", "file")
+	t.Setenv("OUTPUT_DIR", t.TempDir())
+	ctx := context.Background()
+
+	if err := writeManifest(ctx, &Manifest{RunID: "genres", Complete: true, RunPrefix: "genres", Entities: []string{"genres"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readManifest(ctx, manifestKey); err == nil {
+		t.Error("an entity-restricted run became the latest manifest with no full run to merge into")
+	}
+	if _, err := readManifest(ctx, "genres/"+manifestKey); err != nil {
+		t.Errorf("run manifest wasn't written: %v", err)
+	}
+}
+
+func TestWriteManifestSkipsLatestForPartialRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest Manifest
+	}{
+		{"incomplete", Manifest{}},
+		{"backfill", Manifest{Complete: true, Backfill: true}},
+		{"capped", Manifest{Complete: true, Capped: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OUTPUT_TARGET", "file")
+			t.Setenv("OUTPUT_DIR", t.TempDir())
+			ctx := context.Background()
+
+			m := tt.manifest
+			m.RunID, m.RunPrefix = "run", "run"
+			if err := writeManifest(ctx, &m); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readManifest(ctx, manifestKey); err == nil {
+				t.Error("run replaced the latest manifest")
+			}
+			if _, err := readManifest(ctx, "run/"+manifestKey); err != nil {
+				t.Errorf("run manifest wasn't written: %v", err)
+			}
+		})
+	}
+}
+
+func TestIncrementalBoundary(t *testing.T) {
+	started := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		want     int64
+	}{
+		{"high-water mark", &Manifest{Complete: true, HighWaterMark: 1500, StartedAt: started, CompletedAt: 2000}, 1500},
+		{"no games fetched yet", &Manifest{Complete: true, StartedAt: started, CompletedAt: 2000}, 0},
+		{"incomplete run", &Manifest{HighWaterMark: 1500}, 0},
+		{"no manifest", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OUTPUT_TARGET", "file")
+			t.Setenv("OUTPUT_DIR", t.TempDir())
+			ctx := context.Background()
+
+			if tt.manifest != nil {
+				tt.manifest.RunID, tt.manifest.RunPrefix = "run", "run"
+				data, _ := json.Marshal(tt.manifest)
+				if err := writeOutput(ctx, manifestKey, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := incrementalBoundary(ctx); got != tt.want {
+				t.Errorf("incrementalBoundary = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMetricsNamespace = "GameSearch/Extract"
+
+// requestStats accumulates the requests made for one entity.
+type requestStats struct {
+	count     int
+	errors    int
+	latencies []time.Duration
+}
+
+// percentile returns the p-th percentile (0-100) of the recorded latencies.
+func (r *requestStats) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(r.latencies)
+	slices.Sort(sorted)
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+// RecordRequest implements igdb.Recorder.
+func (s *RunSummary) RecordRequest(entity string, elapsed time.Duration, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.requests[entity]
+	if !ok {
+		stats = new(requestStats)
+		s.requests[entity] = stats
+	}
+	stats.count++
+	stats.latencies = append(stats.latencies, elapsed)
+	if err != nil {
+		stats.errors++
+	}
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+// emfLine builds a CloudWatch Embedded Metric Format record. values holds both the metric
+// values and the dimension values, keyed by name as EMF requires.
+func emfLine(namespace string, dimensions []string, metrics []emfMetric, values map[string]any) ([]byte, error) {
+	record := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []emfDirective{{
+				Namespace:  namespace,
+				Dimensions: [][]string{dimensions},
+				Metrics:    metrics,
+			}},
+		},
+	}
+	for k, v := range values {
+		record[k] = v
+	}
+	return json.Marshal(record)
+}
+
+var entityMetrics = []emfMetric{
+	{Name: "Requests", Unit: "Count"},
+	{Name: "RequestErrors", Unit: "Count"},
+	{Name: "LatencyP50", Unit: "Milliseconds"},
+	{Name: "LatencyP99", Unit: "Milliseconds"},
+	{Name: "Records", Unit: "Count"},
+}
+
+// emitMetrics reports per-entity request counts, error counts, latency percentiles and record
+// totals plus the run duration. Inside Lambda they are printed to stdout in Embedded Metric
+// Format so CloudWatch extracts them from the logs; elsewhere they are only logged.
+func emitMetrics(logger *log.Entry, s *RunSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inLambda := os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultMetricsNamespace
+	}
+
+	for entity, stats := range s.requests {
+		values := map[string]any{
+			"Entity":        entity,
+			"RunID":         s.RunID,
+			"Requests":      stats.count,
+			"RequestErrors": stats.errors,
+			"LatencyP50":    stats.percentile(50).Milliseconds(),
+			"LatencyP99":    stats.percentile(99).Milliseconds(),
+			"Records":       0,
+		}
+		if e, ok := s.Entities[entity]; ok {
+			values["Records"] = e.Records
+		}
+
+		if !inLambda {
+			logger.WithFields(values).Info("Request metrics")
+			continue
+		}
+		line, err := emfLine(namespace, []string{"Entity"}, entityMetrics, values)
+		if err != nil {
+			logger.Errorf("Error marshaling metrics for %s: %v", entity, err)
+			continue
+		}
+		fmt.Fprintln(os.Stdout, string(line))
+	}
+
+	duration := s.FinishedAt.Sub(s.StartedAt)
+	if !inLambda {
+		logger.WithField("duration_ms", duration.Milliseconds()).Info("Run metrics")
+		return
+	}
+	line, err := emfLine(namespace, []string{}, []emfMetric{{Name: "RunDuration", Unit: "Milliseconds"}},
+		map[string]any{"RunDuration": duration.Milliseconds(), "RunID": s.RunID})
+	if err != nil {
+		logger.Errorf("Error marshaling run metrics: %v", err)
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(line))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+const (
+	outputTargetS3   = "s3"
+	outputTargetFile = "file"
+)
+
+// Writer is a destination for the extractor's output files. Keys are slash-separated paths
+// such as 2024-01-01T00:00:00Z/games.json.
+type Writer interface {
+	// Write stores data under key, replacing any previous contents.
+	Write(ctx context.Context, key string, data []byte) error
+	// Read returns the contents stored under key, e.g. a previous run's manifest.
+	Read(ctx context.Context, key string) ([]byte, error)
+	// Create returns a streamWriter whose contents are stored under key once it is closed.
+	Create(ctx context.Context, key string) (streamWriter, error)
+	// Delete removes key. Deleting a key that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// streamWriter receives a file piece by piece. Abort discards whatever was written.
+type streamWriter interface {
+	io.WriteCloser
+	Abort()
+}
+
+// outputTarget returns OUTPUT_TARGET, defaulting to s3.
+func outputTarget() (string, error) {
+	switch target := os.Getenv("OUTPUT_TARGET"); target {
+	case "":
+		return outputTargetS3, nil
+	case outputTargetS3, outputTargetFile:
+		return target, nil
+	default:
+		return "", fmt.Errorf("Invalid OUTPUT_TARGET %q: expected s3 or file", target)
+	}
+}
+
+// outputWriter returns the Writer selected by OUTPUT_TARGET. The file target writes under
+// OUTPUT_DIR, defaulting to the working directory.
+func outputWriter() (Writer, error) {
+	target, err := outputTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	if target == outputTargetFile {
+		dir := os.Getenv("OUTPUT_DIR")
+		if dir == "" {
+			dir = "."
+		}
+		return &fileWriter{dir: dir}, nil
+	}
+
+	bucketName := os.Getenv("S3_BUCKET")
+	if bucketName == "" {
+		return nil, fmt.Errorf("S3_BUCKET variable is required but not set")
+	}
+	storageClass, err := parseStorageClass(os.Getenv("S3_STORAGE_CLASS"))
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{
+		bucket:       bucketName,
+		kmsKeyID:     os.Getenv("S3_KMS_KEY_ID"),
+		storageClass: storageClass,
+	}, nil
+}
+
+// writeOutput writes data under key to the configured target. Keys ending in .gz are
+// gzip-compressed first. In a dry run nothing is written.
+func writeOutput(ctx context.Context, key string, data []byte) error {
+	_, err := writeOutputChecksum(ctx, key, data)
+	return err
+}
+
+// writeOutputChecksum is writeOutput, also returning the checksum of the bytes as stored.
+func writeOutputChecksum(ctx context.Context, key string, data []byte) (string, error) {
+	if strings.HasSuffix(key, ".gz") {
+		compressed, err := gzipData(data, runtime.NumCPU())
+		if err != nil {
+			return "", fmt.Errorf("Error compressing %s: %v", key, err)
+		}
+		data = compressed
+	}
+	sum := sha256Checksum(data)
+
+	if dryRun() {
+		return sum, nil
+	}
+
+	w, err := outputWriter()
+	if err != nil {
+		return "", err
+	}
+	return sum, w.Write(ctx, key, data)
+}
+
+// sha256Checksum returns the base64-encoded SHA-256 of data, the form S3 uses for checksums.
+func sha256Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readOutput reads key from the configured target, decompressing keys that end in .gz.
+func readOutput(ctx context.Context, key string) ([]byte, error) {
+	w, err := outputWriter()
+	if err != nil {
+		return nil, err
+	}
+	data, err := w.Read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(key, ".gz") {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing %s: %v", key, err)
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return data, nil
+}
+
+// deleteOutput removes key from the configured target. In a dry run nothing is deleted.
+func deleteOutput(ctx context.Context, key string) error {
+	if dryRun() {
+		return nil
+	}
+	w, err := outputWriter()
+	if err != nil {
+		return err
+	}
+	return w.Delete(ctx, key)
+}
+
+// fileWriter stores output files under dir, creating subdirectories as needed. Files are
+// written to a temporary name in the same directory and renamed into place, so readers never
+// see a partially written file.
+type fileWriter struct {
+	dir string
+}
+
+func (w *fileWriter) path(key string) string {
+	return filepath.Join(w.dir, filepath.FromSlash(key))
+}
+
+func (w *fileWriter) Write(ctx context.Context, key string, data []byte) error {
+	name := w.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %v", name, err)
+	}
+	f, err := createTemp(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("Error writing %s: %v", name, err)
+	}
+	return commitTemp(f, name)
+}
+
+// createTemp creates a temporary file next to name, so it can later be renamed over name.
+func createTemp(name string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating %s: %v", name, err)
+	}
+	return f, nil
+}
+
+// commitTemp closes the temporary file f and renames it to name, removing it on failure.
+func commitTemp(f *os.File, name string) error {
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp makes the file owner-only; output files are meant to be shared
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+func (w *fileWriter) Read(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(w.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", w.path(key), err)
+	}
+	return data, nil
+}
+
+func (w *fileWriter) Create(ctx context.Context, key string) (streamWriter, error) {
+	name := w.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, fmt.Errorf("Error creating directory for %s: %v", name, err)
+	}
+	f, err := createTemp(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStreamWriter{File: f, name: name}, nil
+}
+
+func (w *fileWriter) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(w.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Error deleting %s: %v", w.path(key), err)
+	}
+	return nil
+}
+
+// fileStreamWriter is a streamWriter backed by a temporary file that Close renames to name.
+type fileStreamWriter struct {
+	*os.File
+	name string
+}
+
+func (w *fileStreamWriter) Close() error {
+	return commitTemp(w.File, w.name)
+}
+
+func (w *fileStreamWriter) Abort() {
+	w.File.Close()
+	os.Remove(w.Name())
+}
+
+// discardStreamWriter drops everything written to it, for dry runs.
+type discardStreamWriter struct{}
+
+func (discardStreamWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (discardStreamWriter) Close() error                { return nil }
+func (discardStreamWriter) Abort()                      {}
+
+// streamOutput fetches every page of query and writes each record to key as a line of NDJSON
+// while the pages arrive, instead of holding the whole result set in memory. Page failures
+// are returned as a *FetchError alongside a completed write of the records that were fetched.
+func streamOutput[T igdb.Entity](ctx context.Context, f *igdb.Fetcher[T], key, query string, numWorkers, pageLimit int) (int, error) {
+	var w streamWriter = discardStreamWriter{}
+	if !dryRun() {
+		out, err := outputWriter()
+		if err != nil {
+			return 0, err
+		}
+		w, err = out.Create(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	count, err := f.FetchEach(query, numWorkers, pageLimit, func(page []T) error {
+		for _, record := range page {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	var fetchErr *igdb.FetchError
+	if err != nil && !errors.As(err, &fetchErr) {
+		w.Abort()
+		return count, err
+	}
+
+	if closeErr := w.Close(); closeErr != nil {
+		w.Abort()
+		return count, closeErr
+	}
+	return count, err
+}
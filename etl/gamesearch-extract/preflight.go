@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// preflight pings each endpoint before the extraction starts, so bad credentials or an
+// unreachable IGDB fail the run in seconds with one clear error instead of surfacing as
+// per-page failures minutes in.
+func preflight(ctx context.Context, logger *log.Entry, client *igdb.Client, endpoints []string) error {
+	logger.Infof("Running preflight checks against %v", endpoints)
+	for _, endpoint := range endpoints {
+		err := client.Ping(ctx, endpoint)
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, igdb.ErrAuth):
+			return fmt.Errorf("Preflight failed: IGDB rejected the access token for %s, check CLIENT_ID and CLIENT_SECRET: %v", endpoint, err)
+		default:
+			return fmt.Errorf("Preflight failed: couldn't query %s: %v", endpoint, err)
+		}
+	}
+	logger.Info("Preflight checks passed")
+	return nil
+}
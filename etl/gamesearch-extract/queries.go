@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// entityFields lists the IGDB fields requested for each endpoint. Each list can be replaced
+// with IGDB_FIELDS_<ENTITY>, e.g. IGDB_FIELDS_GAMES="id, name, rating", to experiment with
+// fields without a code change; fields without a matching struct field are dropped on decode.
+var entityFields = map[string]string{
+	"games":              "id, name, slug, first_release_date, dlcs, franchises, genres, themes, game_localizations, multiplayer_modes, platforms, ports, involved_companies, cover, alternative_names, summary, updated_at, rating, rating_count, aggregated_rating",
+	"genres":             "id, name",
+	"themes":             "id, name",
+	"franchises":         "id, name, games",
+	"covers":             "id, game, height, width, url, image_id",
+	"external_games":     "id, category, uid, url, game",
+	"regions":            "id, name, identifier",
+	"platforms":          "id, name, abbreviation",
+	"game_localizations": "id, name, region, game",
+	"companies":          "id, name",
+	"involved_companies": "id, company, game, developer, publisher",
+	"alternative_names":  "id, name, comment, game",
+}
+
+// fieldsQuery returns the fields clause for entity.
+func fieldsQuery(entity string) string {
+	fields, ok := entityFields[entity]
+	if !ok {
+		panic(fmt.Sprintf("no fields configured for %s", entity))
+	}
+	if v := os.Getenv("IGDB_FIELDS_" + strings.ToUpper(entity)); v != "" {
+		fields = v
+	}
+	return fmt.Sprintf("fields %s;", fields)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+	"path"
+)
+
+// outputRawStore is an igdb.RawStore that writes each raw page to
+// <prefix>/raw/<entity>/<page>.json on the configured output target.
+type outputRawStore struct {
+	ctx    context.Context
+	prefix string
+}
+
+func (s *outputRawStore) SaveRaw(entity, page string, body []byte) error {
+	return writeOutput(s.ctx, path.Join(s.prefix, "raw", entity, page+".json"), body)
+}
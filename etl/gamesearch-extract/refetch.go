@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// refetchBatchSize matches IGDB's maximum page size.
+const refetchBatchSize = igdb.MaxPageLimit
+
+// RefetchReport summarizes how a targeted refetch changed the stored games file.
+type RefetchReport struct {
+	Updated   []int `json:"updated"`
+	Added     []int `json:"added"`
+	Unchanged []int `json:"unchanged"`
+	// Removed lists stored games that enrichment filters now drop, e.g. for an empty summary
+	Removed  []int `json:"removed"`
+	NotFound []int `json:"not_found"`
+}
+
+// parseIDs parses IDs given as separate or comma-separated arguments.
+func parseIDs(args []string) ([]int, error) {
+	var ids []int
+	for _, arg := range args {
+		for _, field := range strings.Split(arg, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ID %q: %v", field, err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no IDs given")
+	}
+	return ids, nil
+}
+
+func idList(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// refetchableFiles are the output files holding the whole games catalog that a refetch can
+// merge into, in order of preference. Delta and backfill files only hold part of it.
+var refetchableFiles = []string{"games.json", "games.ndjson", "dataset.json"}
+
+// storedGames is the games file of the latest run, as read by loadStoredGames.
+type storedGames struct {
+	// filename is the file's name in the manifest, e.g. games.ndjson
+	filename string
+	key      string
+	games    []igdb.Game
+	// dataset is set when the games came from a combined dataset.json
+	dataset *Dataset
+}
+
+// loadStoredGames reads the latest run's games file, located through its manifest.
+func loadStoredGames(ctx context.Context, manifest *Manifest) (*storedGames, error) {
+	stored := new(storedGames)
+	for _, filename := range refetchableFiles {
+		if key, ok := manifest.Keys[filename]; ok {
+			stored.filename, stored.key = filename, key
+			break
+		}
+	}
+	if stored.key == "" {
+		return nil, fmt.Errorf("Latest run %s has no games file to refetch into, expected one of %v", manifest.RunID, refetchableFiles)
+	}
+
+	data, err := readOutput(ctx, stored.key)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case stored.filename == "dataset.json":
+		stored.dataset = new(Dataset)
+		err = json.Unmarshal(data, stored.dataset)
+		stored.games = stored.dataset.Games
+	case strings.HasSuffix(stored.filename, ".ndjson"):
+		stored.games, err = decodeNDJSON[igdb.Game](data)
+	default:
+		err = json.Unmarshal(data, &stored.games)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding stored games from %s: %v", stored.key, err)
+	}
+	return stored, nil
+}
+
+// encode encodes games in the stored file's format.
+func (s *storedGames) encode(games []igdb.Game) ([]byte, any, error) {
+	if s.dataset != nil {
+		dataset := *s.dataset
+		dataset.Games = games
+		data, err := marshalOutput(dataset)
+		return data, dataset, err
+	}
+	format := outputFormatJSON
+	if strings.HasSuffix(s.filename, ".ndjson") {
+		format = outputFormatNDJSON
+	}
+	data, err := encodeOutput(games, format)
+	return data, games, err
+}
+
+// storedLookups returns the latest run's genre, theme and franchise names for enrichment.
+func storedLookups(ctx context.Context, manifest *Manifest, stored *storedGames) (*nameLookups, error) {
+	if stored.dataset != nil {
+		return newNameLookups(stored.dataset.Genres, stored.dataset.Themes, stored.dataset.Franchises), nil
+	}
+	genres, err := readStoredRecords[igdb.Genre](ctx, manifest, "genres")
+	if err != nil {
+		return nil, err
+	}
+	themes, err := readStoredRecords[igdb.Theme](ctx, manifest, "themes")
+	if err != nil {
+		return nil, err
+	}
+	franchises, err := readStoredRecords[igdb.Franchise](ctx, manifest, "franchises")
+	if err != nil {
+		return nil, err
+	}
+	return newNameLookups(genres, themes, franchises), nil
+}
+
+// readStoredRecords reads the latest run's file of entity, in either output format.
+func readStoredRecords[T igdb.Entity](ctx context.Context, manifest *Manifest, entity string) ([]T, error) {
+	for _, filename := range []string{entity + ".json", entity + ".ndjson"} {
+		key, ok := manifest.Keys[filename]
+		if !ok {
+			continue
+		}
+		data, err := readOutput(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var records []T
+		if strings.HasSuffix(filename, ".ndjson") {
+			records, err = decodeNDJSON[T](data)
+		} else {
+			err = json.Unmarshal(data, &records)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding stored %s from %s: %v", entity, key, err)
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("Latest run %s has no %s file, which enriching refetched games needs", manifest.RunID, entity)
+}
+
+func decodeNDJSON[T any](data []byte) ([]T, error) {
+	var records []T
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var record T
+		if err := dec.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// fetchWhere fetches the records of endpoint whose field is one of ids, in batches that keep
+// each query short. Records page by ID, since a batch can match more than one page. Batches go
+// through pageFetcher, so they come from opts' injected fetchers or fixtures when it has any.
+func fetchWhere[T igdb.Entity](ctx context.Context, opts runOptions, client *igdb.Client, endpoint, field string, ids []int) ([]T, error) {
+	var records []T
+	for start := 0; start < len(ids); start += refetchBatchSize {
+		batch := ids[start:min(start+refetchBatchSize, len(ids))]
+		f := igdb.NewFetcher[T](ctx, client, endpoint)
+		f.Pagination = igdb.PaginationKeyset
+
+		query := fmt.Sprintf("%s\nwhere %s = (%s);", fieldsQuery(endpoint), field, idList(batch))
+		res, err := pageFetcher(opts, client, f).FetchAll(query, 1, igdb.MaxPageLimit)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching %s %d-%d of %d: %w", endpoint, start+1, start+len(batch), len(ids), err)
+		}
+		records = append(records, res...)
+	}
+	return records, nil
+}
+
+// coverIDs returns the IDs of the covers games reference.
+func coverIDs(games []igdb.Game) []int {
+	var ids []int
+	for _, g := range games {
+		if g.Cover != 0 {
+			ids = append(ids, g.Cover)
+		}
+	}
+	return ids
+}
+
+// attachRefetchLinks fetches the records linked to games, restricted to those games, and
+// attaches them the same way a full run does with the whole catalog.
+func attachRefetchLinks(ctx context.Context, logger *log.Entry, client *igdb.Client, games []igdb.Game) error {
+	gameIDs := make([]int, len(games))
+	for i, g := range games {
+		gameIDs[i] = g.ID
+	}
+
+	logger.Info("Fetching covers of the refetched games...")
+	covers, err := fetchWhere[igdb.Cover](ctx, runOptions{}, client, "covers", "id", coverIDs(games))
+	if err != nil {
+		return err
+	}
+	attachCoverURLs(games, covers)
+
+	if os.Getenv("FETCH_EXTERNAL_GAMES") == "true" {
+		logger.Info("Fetching external games of the refetched games...")
+		externalGames, err := fetchWhere[igdb.ExternalGame](ctx, runOptions{}, client, "external_games", "game", gameIDs)
+		if err != nil {
+			return err
+		}
+		attachStoreLinks(games, externalGames)
+	}
+
+	if os.Getenv("FETCH_LOCALIZATIONS") == "true" {
+		logger.Info("Fetching localizations of the refetched games...")
+		regions, err := igdb.NewFetcher[igdb.Region](ctx, client, "regions").FetchAll(fieldsQuery("regions"), 1, igdb.MaxPageLimit)
+		if err != nil {
+			return fmt.Errorf("Error fetching regions: %w", err)
+		}
+		localizations, err := fetchWhere[igdb.GameLocalization](ctx, runOptions{}, client, "game_localizations", "game", gameIDs)
+		if err != nil {
+			return err
+		}
+		attachLocalizedTitles(games, localizations, regions)
+	}
+
+	if os.Getenv("FETCH_ALTERNATIVE_NAMES") == "true" {
+		logger.Info("Fetching alternative names of the refetched games...")
+		altNames, err := fetchWhere[igdb.AlternativeName](ctx, runOptions{}, client, "alternative_names", "game", gameIDs)
+		if err != nil {
+			return err
+		}
+		attachAltNames(games, altNames)
+	}
+
+	if os.Getenv("FETCH_COMPANIES") == "true" {
+		logger.Info("Fetching companies of the refetched games...")
+		involved, err := fetchWhere[igdb.InvolvedCompany](ctx, runOptions{}, client, "involved_companies", "game", gameIDs)
+		if err != nil {
+			return err
+		}
+		companyIDs := make([]int, 0, len(involved))
+		for _, ic := range involved {
+			if !slices.Contains(companyIDs, ic.Company) {
+				companyIDs = append(companyIDs, ic.Company)
+			}
+		}
+		companies, err := fetchWhere[igdb.Company](ctx, runOptions{}, client, "companies", "id", companyIDs)
+		if err != nil {
+			return err
+		}
+		attachCompanies(games, involved, companies)
+	}
+	return nil
+}
+
+// refetchGames fetches the given games by ID, enriches them like a full run would and merges
+// them into the latest run's games file, updating its manifest to match.
+func refetchGames(ctx context.Context, logger *log.Entry, ids []int) (*RefetchReport, error) {
+	if err := validateEnv(ctx, false); err != nil {
+		return nil, err
+	}
+	enrichment, err := loadGameEnrichment()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readManifest(ctx, manifestKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the latest manifest, which refetch needs to find the games file: %w", err)
+	}
+	stored, err := loadStoredGames(ctx, manifest)
+	if err != nil {
+		return nil, err
+	}
+	lookups := newNameLookups(nil, nil, nil)
+	if enrichment.needsNames() {
+		if lookups, err = storedLookups(ctx, manifest, stored); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := newIGDBClient(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Refetching %d games...", len(ids))
+	fetched, err := fetchWhere[igdb.Game](ctx, runOptions{}, client, "games", "id", ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachRefetchLinks(ctx, logger, client, fetched); err != nil {
+		return nil, err
+	}
+	kept := enrichment.apply(ctx, logger, slices.Clone(fetched), lookups)
+
+	merged, report := mergeGames(stored.games, fetched, kept, ids)
+
+	data, value, err := stored.encode(merged)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling merged games: %v", err)
+	}
+	sum, err := writeOutputChecksum(ctx, stored.key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Records[stored.filename] = recordCount(value)
+	if manifest.Checksums == nil {
+		manifest.Checksums = make(map[string]string)
+	}
+	manifest.Checksums[stored.filename] = sum
+	if err := writeManifest(ctx, manifest); err != nil {
+		return nil, fmt.Errorf("Error updating the manifest after refetching: %w", err)
+	}
+
+	logger.WithFields(log.Fields{
+		"updated":   report.Updated,
+		"added":     report.Added,
+		"unchanged": report.Unchanged,
+		"removed":   report.Removed,
+		"not_found": report.NotFound,
+	}).Info("Refetch complete")
+
+	return report, nil
+}
+
+// mergeGames upserts the refetched games that enrichment kept into games by ID, preserving the
+// existing order and appending games that weren't stored before. Refetched games the
+// enrichment filters dropped, e.g. for an empty summary, are removed from games.
+func mergeGames(games, fetched, kept []igdb.Game, requested []int) ([]igdb.Game, *RefetchReport) {
+	report := new(RefetchReport)
+
+	index := make(map[int]int, len(games))
+	for i, g := range games {
+		index[g.ID] = i
+	}
+
+	seen := make(map[int]bool, len(fetched))
+	for _, g := range fetched {
+		seen[g.ID] = true
+	}
+
+	retained := make(map[int]bool, len(kept))
+	for _, g := range kept {
+		retained[g.ID] = true
+		i, ok := index[g.ID]
+		switch {
+		case !ok:
+			index[g.ID] = len(games)
+			games = append(games, g)
+			report.Added = append(report.Added, g.ID)
+		case reflect.DeepEqual(games[i], g):
+			report.Unchanged = append(report.Unchanged, g.ID)
+		default:
+			games[i] = g
+			report.Updated = append(report.Updated, g.ID)
+		}
+	}
+
+	games = slices.DeleteFunc(games, func(g igdb.Game) bool {
+		if seen[g.ID] && !retained[g.ID] {
+			report.Removed = append(report.Removed, g.ID)
+			return true
+		}
+		return false
+	})
+
+	for _, id := range requested {
+		if !seen[id] {
+			report.NotFound = append(report.NotFound, id)
+		}
+	}
+
+	return games, report
+}
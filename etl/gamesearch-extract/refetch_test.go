@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+func TestMergeGames(t *testing.T) {
+	stored := []igdb.Game{
+		{ID: 1, Name: "One", GenreNames: []string{"RPG"}},
+		{ID: 2, Name: "Two"},
+		{ID: 3, Name: "Three", Summary: "Gone soon"},
+	}
+	fetched := []igdb.Game{
+		{ID: 1, Name: "One", GenreNames: []string{"RPG"}},
+		{ID: 2, Name: "Two, renamed"},
+		{ID: 3, Name: "Three"},
+		{ID: 4, Name: "Four"},
+	}
+	// Enrichment dropped game 3, e.g. for its now empty summary
+	kept := []igdb.Game{fetched[0], fetched[1], fetched[3]}
+
+	merged, report := mergeGames(slices.Clone(stored), fetched, kept, []int{1, 2, 3, 4, 5})
+
+	var ids []int
+	for _, g := range merged {
+		ids = append(ids, g.ID)
+	}
+	if !slices.Equal(ids, []int{1, 2, 4}) {
+		t.Errorf("merged IDs = %v, want [1 2 4]", ids)
+	}
+	if merged[1].Name != "Two, renamed" {
+		t.Errorf("game 2 wasn't updated: %+v", merged[1])
+	}
+
+	for name, got := range map[string][]int{
+		"unchanged": report.Unchanged, "updated": report.Updated, "added": report.Added,
+		"removed": report.Removed, "not found": report.NotFound,
+	} {
+		want := map[string][]int{"unchanged": {1}, "updated": {2}, "added": {4}, "removed": {3}, "not found": {5}}[name]
+		if !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// fakeRefetchIGDB serves a Twitch token and the games and covers endpoints for the given games,
+// answering "where id = (...)" queries the way refetch makes them.
+func fakeRefetchIGDB(t *testing.T, games map[int]igdb.Game) *httptest.Server {
+	t.Helper()
+	idsPattern := regexp.MustCompile(`id = \(([\d,]+)\)`)
+	afterPattern := regexp.MustCompile(`id > (\d+)`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"access_token":"test","expires_in":3600,"token_type":"bearer"}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		ids, _ := parseIDs([]string{idsPattern.FindStringSubmatch(string(body))[1]})
+		after, _ := strconv.Atoi(afterPattern.FindStringSubmatch(string(body))[1])
+		slices.Sort(ids)
+
+		var records []any
+		for _, id := range ids {
+			g, ok := games[id]
+			switch {
+			case id <= after:
+			case r.URL.Path == "/games" && ok:
+				records = append(records, g)
+			case r.URL.Path == "/covers":
+				records = append(records, igdb.Cover{ID: id, ImageID: fmt.Sprintf("img%d", id)})
+			}
+		}
+		if records == nil {
+			records = []any{}
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRefetchGamesEnrichesAndUpdatesManifest(t *testing.T) {
+	dir := t.TempDir()
+	srv := fakeRefetchIGDB(t, map[int]igdb.Game{
+		1: {ID: 1, Name: "One, renamed", Genres: []int{12}, Cover: 101, Summary: "First"},
+		3: {ID: 3, Name: "Three", Genres: []int{12}, Summary: "Third"},
+	})
+	for name, value := range map[string]string{
+		"OUTPUT_TARGET": "file", "OUTPUT_DIR": dir, "PRETTY_OUTPUT": "false",
+		"CLIENT_ID": "id", "CLIENT_SECRET": "secret",
+		"IGDB_AUTH_URL": srv.URL + "/token", "IGDB_BASE_URL": srv.URL,
+		"RESOLVE_NAMES": "true", "SKIP_EMPTY_SUMMARY": "true",
+	} {
+		t.Setenv(name, value)
+	}
+	ctx := context.Background()
+
+	stored := []igdb.Game{
+		{ID: 1, Name: "One", Genres: []int{12}, Summary: "First", GenreNames: []string{"RPG"}},
+		{ID: 2, Name: "Two", Summary: "Second"},
+	}
+	var ndjson bytes.Buffer
+	for _, g := range stored {
+		json.NewEncoder(&ndjson).Encode(g)
+	}
+	genres, _ := json.Marshal([]igdb.Genre{{ID: 12, Name: "RPG"}})
+	empty := []byte("[]")
+	for key, data := range map[string][]byte{
+		"run/games.ndjson": ndjson.Bytes(), "run/genres.json": genres, "run/themes.json": empty, "run/franchises.json": empty,
+	} {
+		if err := writeOutput(ctx, key, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeManifest(ctx, &Manifest{
+		RunID: "run", Complete: true, RunPrefix: "run",
+		Keys: map[string]string{
+			"games.ndjson": "run/games.ndjson", "genres.json": "run/genres.json",
+			"themes.json": "run/themes.json", "franchises.json": "run/franchises.json",
+		},
+		Records: map[string]int{"games.ndjson": 2, "genres.json": 1, "themes.json": 0, "franchises.json": 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := refetchGames(ctx, log.NewEntry(log.New()), []int{1, 3})
+	if err != nil {
+		t.Fatalf("refetchGames: %v", err)
+	}
+	if !slices.Equal(report.Updated, []int{1}) || !slices.Equal(report.Added, []int{3}) {
+		t.Errorf("report = %+v, want game 1 updated and 3 added", report)
+	}
+
+	data, err := readOutput(ctx, "run/games.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	games, err := decodeNDJSON[igdb.Game](data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 3 {
+		t.Fatalf("stored %d games, want 3", len(games))
+	}
+	if g := games[0]; g.Name != "One, renamed" || !slices.Equal(g.GenreNames, []string{"RPG"}) || g.CoverURL == "" {
+		t.Errorf("refetched game wasn't enriched: %+v", g)
+	}
+
+	manifest, err := readManifest(ctx, manifestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Records["games.ndjson"] != 3 || manifest.Checksums["games.ndjson"] != sha256Checksum(data) {
+		t.Errorf("manifest wasn't updated: records %d, checksum %q", manifest.Records["games.ndjson"], manifest.Checksums["games.ndjson"])
+	}
+}
+
+func TestRefetchGamesNeedsGamesFileInManifest(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("OUTPUT_TARGET", "file")
+	t.Setenv("OUTPUT_DIR", dir)
+	t.Setenv("CLIENT_ID", "id")
+	t.Setenv("CLIENT_SECRET", "secret")
+	ctx := context.Background()
+
+	if err := writeManifest(ctx, &Manifest{
+		RunID: "delta", Complete: true, RunPrefix: "delta",
+		Keys: map[string]string{"games_delta.json": "delta/games_delta.json"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refetchGames(ctx, log.NewEntry(log.New()), []int{1}); err == nil {
+		t.Fatal("refetchGames succeeded without a full games file in the manifest")
+	}
+}
+
+func TestRefetchGamesAfterIncrementalRun(t *testing.T) {
+	setOfflineEnv(t)
+	fixtures := t.TempDir()
+	t.Setenv("IGDB_FIXTURE_DIR", fixtures)
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	writeFixture := func(games []igdb.Game) {
+		data, _ := json.Marshal(games)
+		if err := os.WriteFile(filepath.Join(fixtures, "games.json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFixture([]igdb.Game{{ID: 1, Name: "One", UpdatedAt: 100}, {ID: 2, Name: "Two", UpdatedAt: 100}})
+	if _, err := fetchAndStoreData(ctx, logger, "full", runOptions{Prefix: "full"}); err != nil {
+		t.Fatalf("full run: %v", err)
+	}
+
+	t.Setenv("INCREMENTAL", "true")
+	writeFixture([]igdb.Game{{ID: 2, Name: "Two, renamed", UpdatedAt: 200}})
+	if _, err := fetchAndStoreData(ctx, logger, "delta", runOptions{Prefix: "delta"}); err != nil {
+		t.Fatalf("incremental run: %v", err)
+	}
+
+	latest, err := readManifest(ctx, manifestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Keys["games.json"] != "full/games.json" || latest.Keys["games_delta.json"] != "delta/games_delta.json" {
+		t.Errorf("keys = %v, want the full run's games.json next to the incremental run's delta", latest.Keys)
+	}
+	if latest.HighWaterMark != 200 || !slices.Equal(latest.MergedRuns, []string{"delta"}) {
+		t.Errorf("high-water mark %d, merged runs %v; want 200 and the incremental run", latest.HighWaterMark, latest.MergedRuns)
+	}
+
+	srv := fakeRefetchIGDB(t, map[int]igdb.Game{3: {ID: 3, Name: "Three"}})
+	t.Setenv("IGDB_FIXTURE_DIR", "")
+	t.Setenv("CLIENT_ID", "id")
+	t.Setenv("CLIENT_SECRET", "secret")
+	t.Setenv("IGDB_AUTH_URL", srv.URL+"/token")
+	t.Setenv("IGDB_BASE_URL", srv.URL)
+	report, err := refetchGames(ctx, logger, []int{3})
+	if err != nil {
+		t.Fatalf("refetchGames after an incremental run: %v", err)
+	}
+	if !slices.Equal(report.Added, []int{3}) {
+		t.Errorf("report = %+v, want game 3 added", report)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+// UndatedPolicy controls where games without a first_release_date (unreleased or unknown)
+// are placed whenever games are ordered or grouped by release date. The default is UndatedLast.
+type UndatedPolicy string
+
+const (
+	UndatedFirst    UndatedPolicy = "first"
+	UndatedLast     UndatedPolicy = "last"
+	UndatedSeparate UndatedPolicy = "separate"
+)
+
+func parseUndatedPolicy(value string) (UndatedPolicy, error) {
+	switch policy := UndatedPolicy(value); policy {
+	case "":
+		return UndatedLast, nil
+	case UndatedFirst, UndatedLast, UndatedSeparate:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid undated policy %q, expected first, last or separate", value)
+}
+
+// sortByReleaseDate stably orders games by release date, placing undated games according to policy.
+// With UndatedSeparate the undated games are removed from the result and returned on their own.
+func sortByReleaseDate(games []igdb.Game, policy UndatedPolicy) (dated []igdb.Game, undated []igdb.Game) {
+	for _, g := range games {
+		if g.FirstReleaseDate == 0 {
+			undated = append(undated, g)
+		} else {
+			dated = append(dated, g)
+		}
+	}
+
+	slices.SortStableFunc(dated, func(a, b igdb.Game) int {
+		return a.FirstReleaseDate - b.FirstReleaseDate
+	})
+
+	switch policy {
+	case UndatedFirst:
+		return append(undated, dated...), nil
+	case UndatedSeparate:
+		return dated, undated
+	default:
+		return append(dated, undated...), nil
+	}
+}
+
+// attachReleaseDateISO sets FirstReleaseDateISO from the Unix FirstReleaseDate, leaving it
+// empty for undated games. The epoch field is kept for existing consumers.
+func attachReleaseDateISO(games []igdb.Game) {
+	for i := range games {
+		if games[i].FirstReleaseDate == 0 {
+			continue
+		}
+		games[i].FirstReleaseDateISO = time.Unix(int64(games[i].FirstReleaseDate), 0).UTC().Format(time.RFC3339)
+	}
+}
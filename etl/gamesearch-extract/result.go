@@ -0,0 +1,48 @@
+package main
+
+import (
+	"maps"
+	"slices"
+)
+
+// Result is what the Lambda handler returns, so a caller such as a Step Functions state
+// machine can branch on what a run extracted, e.g. skip the transform when no games changed.
+type Result struct {
+	RunID    string `json:"run_id"`
+	Duration string `json:"duration"`
+	// Records maps each fetched entity to the number of records fetched.
+	Records map[string]int `json:"records"`
+	// FailedPages maps each fetched entity to the pages that still failed after retries.
+	FailedPages map[string]int `json:"failed_pages"`
+	// UploadedKeys lists the keys written successfully, in sorted order.
+	UploadedKeys []string `json:"uploaded_keys"`
+	// Duplicate is set when the invocation repeated a completed run's idempotency key, in
+	// which case the fields describe that earlier run.
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Refetch is set instead of the fields above for a refetch_ids invocation.
+	Refetch *RefetchReport `json:"refetch,omitempty"`
+}
+
+// result summarizes the run for the handler's return value.
+func (s *RunSummary) result() *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &Result{
+		RunID:        s.RunID,
+		Duration:     s.Duration,
+		Records:      make(map[string]int, len(s.Entities)),
+		FailedPages:  make(map[string]int, len(s.Entities)),
+		UploadedKeys: []string{},
+	}
+	for entity, e := range s.Entities {
+		r.Records[entity] = e.Records
+		r.FailedPages[entity] = e.FailedPages
+	}
+	for _, key := range slices.Sorted(maps.Keys(s.Uploads)) {
+		if s.Uploads[key] == "ok" {
+			r.UploadedKeys = append(r.UploadedKeys, key)
+		}
+	}
+	return r
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 PutObject retries: up to s3MaxRetries after the first attempt, starting from
+// s3RetryBaseDelay and doubling each time.
+const (
+	s3MaxRetries     = 4
+	s3RetryBaseDelay = 500 * time.Millisecond
+)
+
+var (
+	s3Client     *s3.Client
+	s3ClientErr  error
+	s3ClientOnce sync.Once
+)
+
+// getS3Client creates the S3 client on first use so runs writing to local files never need
+// AWS credentials. S3_REGION overrides the region found by the default chain (AWS_REGION, then
+// the shared config), and loading fails when neither yields a region.
+func getS3Client(ctx context.Context) (*s3.Client, error) {
+	s3ClientOnce.Do(func() {
+		var opts []func(*config.LoadOptions) error
+		if region := os.Getenv("S3_REGION"); region != "" {
+			opts = append(opts, config.WithRegion(region))
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			s3ClientErr = fmt.Errorf("Unable to load SDK config: %v", err)
+			return
+		}
+		if cfg.Region == "" {
+			s3ClientErr = fmt.Errorf("No AWS region configured for S3: set AWS_REGION or S3_REGION")
+			return
+		}
+		s3Client = s3.NewFromConfig(cfg)
+	})
+	return s3Client, s3ClientErr
+}
+
+// s3Writer stores output files as objects in bucket. Objects are encrypted with kmsKeyID
+// using SSE-KMS when it is set, and with the bucket's default encryption otherwise. An empty
+// storageClass stores them as STANDARD.
+type s3Writer struct {
+	bucket       string
+	kmsKeyID     string
+	storageClass types.StorageClass
+}
+
+// parseStorageClass validates S3_STORAGE_CLASS against the storage classes the SDK knows,
+// returning "" for STANDARD when it is unset.
+func parseStorageClass(value string) (types.StorageClass, error) {
+	if value == "" {
+		return "", nil
+	}
+	class := types.StorageClass(value)
+	if !slices.Contains(class.Values(), class) {
+		return "", fmt.Errorf("Invalid S3_STORAGE_CLASS %q: expected one of %v", value, class.Values())
+	}
+	return class, nil
+}
+
+// contentType returns the Content-Type for key. Compressed keys keep the type of their
+// contents, since Content-Encoding: gzip already marks them as compressed.
+func contentType(key string) string {
+	key = strings.TrimSuffix(key, ".gz")
+	if strings.HasSuffix(key, ".ndjson") {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// encrypt sets SSE-KMS on a PutObject or CreateMultipartUpload request when a key is configured.
+func (w *s3Writer) encrypt(sse *types.ServerSideEncryption, keyID **string) {
+	if w.kmsKeyID == "" {
+		return
+	}
+	*sse = types.ServerSideEncryptionAwsKms
+	*keyID = aws.String(w.kmsKeyID)
+}
+
+// Write uploads data under key. PutObject replaces the object atomically, so readers see
+// either the previous or the new contents and never a partially written file. Keys ending in
+// .gz are stored with Content-Encoding: gzip. The payload's SHA-256 is sent with the request
+// so S3 rejects a corrupted body, and the checksum S3 reports back is compared against it.
+func (w *s3Writer) Write(ctx context.Context, key string, data []byte) error {
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256Checksum(data)
+	input := &s3.PutObjectInput{
+		Bucket:            &w.bucket,
+		Key:               &key,
+		ContentType:       aws.String(contentType(key)),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(sum),
+		StorageClass:      w.storageClass,
+	}
+	if strings.HasSuffix(key, ".gz") {
+		input.ContentEncoding = aws.String("gzip")
+	}
+	w.encrypt(&input.ServerSideEncryption, &input.SSEKMSKeyId)
+
+	var out *s3.PutObjectOutput
+	err = withS3Retry(ctx, func() error {
+		// The body is read by each attempt, so every retry starts from a fresh reader
+		input.Body = bytes.NewReader(data)
+		out, err = client.PutObject(ctx, input)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to upload data to S3: %v", err)
+	}
+	return verifyChecksum(key, sum, out.ChecksumSHA256)
+}
+
+// withS3Retry runs do, retrying throttling, 5xx and network errors with exponential backoff
+// and jitter. Other errors, such as AccessDenied or NoSuchBucket, are returned immediately,
+// as is the last error once s3MaxRetries retries are used up.
+func withS3Retry(ctx context.Context, do func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := do()
+		if err == nil || attempt == s3MaxRetries || ctx.Err() != nil || !isRetryableS3(err) {
+			return err
+		}
+
+		d := s3RetryBaseDelay << attempt
+		timer := time.NewTimer(d/2 + rand.N(d/2+1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// isRetryableS3 reports whether err is a transient S3 failure: a 429, a 5xx such as
+// 503 SlowDown, or a network error that never got a response.
+func isRetryableS3(err error) bool {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// verifyChecksum fails when S3 reports a different checksum than the one that was sent.
+func verifyChecksum(key, sent string, stored *string) error {
+	if stored != nil && *stored != sent {
+		return fmt.Errorf("Checksum mismatch for %s: sent %s, S3 stored %s", key, sent, *stored)
+	}
+	return nil
+}
+
+func (w *s3Writer) Read(ctx context.Context, key string) ([]byte, error) {
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &w.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s from S3: %v", key, err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (w *s3Writer) Create(ctx context.Context, key string) (streamWriter, error) {
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &s3StreamWriter{ctx: ctx, client: client, target: w, key: key}, nil
+}
+
+func (w *s3Writer) Delete(ctx context.Context, key string) error {
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &w.bucket, Key: &key}); err != nil {
+		return fmt.Errorf("Failed to delete %s from S3: %v", key, err)
+	}
+	return nil
+}
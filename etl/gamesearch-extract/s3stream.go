@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3PartSize is the buffered size at which a multipart part is uploaded. S3 requires every
+// part but the last to be at least 5 MiB.
+const s3PartSize = 8 << 20
+
+// s3StreamWriter uploads everything written to it as a single S3 object using a multipart
+// upload, so memory stays bounded by one part regardless of the object size. Payloads that
+// never fill a part are uploaded with a plain PutObject on Close.
+type s3StreamWriter struct {
+	ctx      context.Context
+	client   *s3.Client
+	target   *s3Writer
+	key      string
+	uploadID *string
+	parts    []types.CompletedPart
+	buf      bytes.Buffer
+}
+
+func (w *s3StreamWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	if w.buf.Len() >= s3PartSize {
+		if err := w.flushPart(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *s3StreamWriter) flushPart() error {
+	if w.uploadID == nil {
+		input := &s3.CreateMultipartUploadInput{
+			Bucket:            &w.target.bucket,
+			Key:               &w.key,
+			ContentType:       aws.String(contentType(w.key)),
+			ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+			StorageClass:      w.target.storageClass,
+		}
+		w.target.encrypt(&input.ServerSideEncryption, &input.SSEKMSKeyId)
+		out, err := w.client.CreateMultipartUpload(w.ctx, input)
+		if err != nil {
+			return fmt.Errorf("Failed to start multipart upload for %s: %v", w.key, err)
+		}
+		w.uploadID = out.UploadId
+	}
+
+	// Each part carries its own SHA-256, and S3 combines them into the object's checksum
+	partNumber := aws.Int32(int32(len(w.parts) + 1))
+	sum := sha256Checksum(w.buf.Bytes())
+	out, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:            &w.target.bucket,
+		Key:               &w.key,
+		UploadId:          w.uploadID,
+		PartNumber:        partNumber,
+		Body:              bytes.NewReader(w.buf.Bytes()),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(sum),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to upload part %d of %s: %v", *partNumber, w.key, err)
+	}
+	if err := verifyChecksum(fmt.Sprintf("part %d of %s", *partNumber, w.key), sum, out.ChecksumSHA256); err != nil {
+		return err
+	}
+
+	w.parts = append(w.parts, types.CompletedPart{ETag: out.ETag, PartNumber: partNumber, ChecksumSHA256: aws.String(sum)})
+	w.buf.Reset()
+	return nil
+}
+
+// Close uploads any buffered data and completes the upload.
+func (w *s3StreamWriter) Close() error {
+	if w.uploadID == nil {
+		return w.target.Write(w.ctx, w.key, w.buf.Bytes())
+	}
+
+	if w.buf.Len() > 0 {
+		if err := w.flushPart(); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &w.target.bucket,
+		Key:             &w.key,
+		UploadId:        w.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to complete multipart upload for %s: %v", w.key, err)
+	}
+	return nil
+}
+
+// Abort discards the upload so no partial object or orphaned parts are left behind.
+func (w *s3StreamWriter) Abort() {
+	if w.uploadID == nil {
+		return
+	}
+	w.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   &w.target.bucket,
+		Key:      &w.key,
+		UploadId: w.uploadID,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+var (
+	secretsClient     *secretsmanager.Client
+	secretsClientErr  error
+	secretsClientOnce sync.Once
+)
+
+// getSecretsClient creates the Secrets Manager client on first use so runs that take their
+// credentials from the environment never need Secrets Manager access.
+func getSecretsClient(ctx context.Context) (*secretsmanager.Client, error) {
+	secretsClientOnce.Do(func() {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			secretsClientErr = err
+			return
+		}
+		secretsClient = secretsmanager.NewFromConfig(cfg)
+	})
+	return secretsClient, secretsClientErr
+}
+
+// secretCredentials reads the IGDB client ID and secret from a Secrets Manager secret holding
+// a JSON object with client_id and client_secret keys.
+func secretCredentials(ctx context.Context, secretID string) (clientID, clientSecret string, err error) {
+	client, err := getSecretsClient(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Unable to create Secrets Manager client: %v", err)
+	}
+
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &secretID})
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read IGDB credentials secret: %v", err)
+	}
+
+	var creds struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &creds); err != nil {
+		return "", "", fmt.Errorf("Error decoding IGDB credentials secret: %v", err)
+	}
+	if creds.ClientID == "" || creds.ClientSecret == "" {
+		return "", "", fmt.Errorf("IGDB credentials secret is missing client_id or client_secret")
+	}
+	return creds.ClientID, creds.ClientSecret, nil
+}
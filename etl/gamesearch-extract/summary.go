@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runSummaryKey is the summary's file name under the run's prefix.
+const runSummaryKey = "run_summary.json"
+
+const (
+	statusSuccess = "success"
+	statusPartial = "partial"
+	statusFailed  = "failed"
+)
+
+// EntitySummary records how fetching a single entity went.
+type EntitySummary struct {
+	Status      string `json:"status"`
+	Records     int    `json:"records"`
+	FailedPages int    `json:"failed_pages"`
+	Error       string `json:"error,omitempty"`
+	Duration    string `json:"duration"`
+}
+
+// RunSummary is a post-mortem record of a run. Unlike the manifest it is written whether or
+// not the run succeeds, so a failed run still shows which entities completed.
+type RunSummary struct {
+	RunID      string                    `json:"run_id"`
+	StartedAt  time.Time                 `json:"started_at"`
+	FinishedAt time.Time                 `json:"finished_at"`
+	Duration   string                    `json:"duration"`
+	Error      string                    `json:"error,omitempty"`
+	Entities   map[string]*EntitySummary `json:"entities"`
+	Uploads    map[string]string         `json:"uploads"`
+	// BytesUploaded is the uncompressed size of the files uploaded successfully.
+	BytesUploaded int `json:"bytes_uploaded"`
+
+	// requests holds per-entity request stats for metrics; they aren't part of the summary file
+	requests map[string]*requestStats
+	// prefix is the run's key prefix, which the summary is written under
+	prefix string
+
+	mu sync.Mutex
+}
+
+func newRunSummary(runID string) *RunSummary {
+	return &RunSummary{
+		RunID:     runID,
+		StartedAt: time.Now().UTC(),
+		Entities:  make(map[string]*EntitySummary),
+		Uploads:   make(map[string]string),
+		requests:  make(map[string]*requestStats),
+	}
+}
+
+// RecordFetch implements igdb.Recorder.
+func (s *RunSummary) RecordFetch(entity string, records, failedPages int, truncated bool, elapsed time.Duration, err error) {
+	if s == nil {
+		return
+	}
+
+	e := &EntitySummary{
+		Status:      statusSuccess,
+		Records:     records,
+		FailedPages: failedPages,
+		Duration:    elapsed.String(),
+	}
+	switch {
+	case err != nil && records == 0:
+		e.Status = statusFailed
+	case err != nil:
+		e.Status = statusPartial
+	case truncated:
+		e.Status = statusPartial
+		e.Error = "stopped early by MAX_RUN_RECORDS or MAX_RECORDS"
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Entities[entity] = e
+}
+
+func (s *RunSummary) recordUpload(key string, size int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.Uploads[key] = err.Error()
+	} else {
+		s.Uploads[key] = "ok"
+		s.BytesUploaded += size
+	}
+}
+
+func (s *RunSummary) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FinishedAt = time.Now().UTC()
+	s.Duration = s.FinishedAt.Sub(s.StartedAt).String()
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// logRunSummary logs the run's totals as a single structured entry, with per-entity record
+// and page counts flattened into fields so they can be queried in CloudWatch Logs Insights.
+func logRunSummary(logger *log.Entry, s *RunSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields := log.Fields{
+		"duration":       s.Duration,
+		"bytes_uploaded": s.BytesUploaded,
+	}
+	totalPages, totalFailed := 0, 0
+	for entity, e := range s.Entities {
+		pages := 0
+		if stats, ok := s.requests[entity]; ok {
+			pages = stats.count
+		}
+		fields[entity+"_records"] = e.Records
+		fields[entity+"_pages"] = pages
+		fields[entity+"_failed_pages"] = e.FailedPages
+		totalPages += pages
+		totalFailed += e.FailedPages
+	}
+	fields["pages"] = totalPages
+	fields["failed_pages"] = totalFailed
+
+	entry := logger.WithFields(fields)
+	if s.Error != "" {
+		entry.WithField("error", s.Error).Error("Run summary")
+		return
+	}
+	entry.Info("Run summary")
+}
+
+// writeRunSummary uploads the summary, falling back to logging it when the upload fails so
+// the post-mortem record is never lost.
+func writeRunSummary(ctx context.Context, logger *log.Entry, s *RunSummary) {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		logger.Errorf("Error marshaling run summary: %v", err)
+		return
+	}
+
+	if dryRun() {
+		logger.WithField("run_summary", string(data)).Info("Dry run, skipping run summary upload")
+		return
+	}
+
+	if err := writeOutput(ctx, path.Join(s.prefix, runSummaryKey), data); err != nil {
+		logger.WithField("run_summary", string(data)).Errorf("Error uploading run summary: %v", err)
+	}
+}
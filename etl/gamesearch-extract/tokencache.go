@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/yangrchen/gamesearch-extract/internal/igdb"
+)
+
+var (
+	ssmClient     *ssm.Client
+	ssmClientErr  error
+	ssmClientOnce sync.Once
+)
+
+// getSSMClient creates the SSM client on first use so runs without a token parameter never
+// need SSM access.
+func getSSMClient(ctx context.Context) (*ssm.Client, error) {
+	ssmClientOnce.Do(func() {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			ssmClientErr = err
+			return
+		}
+		ssmClient = ssm.NewFromConfig(cfg)
+	})
+	return ssmClient, ssmClientErr
+}
+
+// ssmTokenCache keeps the IGDB access token in an SSM SecureString parameter so scheduled runs
+// reuse it until it expires instead of requesting a new token on every invocation.
+type ssmTokenCache struct {
+	ctx    context.Context
+	logger *log.Entry
+	name   string
+}
+
+func (c *ssmTokenCache) Load() (igdb.CachedToken, bool) {
+	var token igdb.CachedToken
+
+	client, err := getSSMClient(c.ctx)
+	if err != nil {
+		c.logger.Warnf("Error creating SSM client, not using the cached token: %v", err)
+		return token, false
+	}
+
+	out, err := client.GetParameter(c.ctx, &ssm.GetParameterInput{
+		Name:           &c.name,
+		WithDecryption: aws.Bool(true),
+	})
+	var notFound *types.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return token, false
+	}
+	if err != nil {
+		c.logger.Warnf("Error reading cached token from %s: %v", c.name, err)
+		return token, false
+	}
+
+	if err := json.Unmarshal([]byte(aws.ToString(out.Parameter.Value)), &token); err != nil {
+		c.logger.Warnf("Ignoring malformed cached token in %s: %v", c.name, err)
+		return token, false
+	}
+	c.logger.Infof("Using cached access token from %s, expires at %s", c.name, token.ExpiresAt)
+	return token, true
+}
+
+func (c *ssmTokenCache) Store(token igdb.CachedToken) {
+	client, err := getSSMClient(c.ctx)
+	if err != nil {
+		c.logger.Warnf("Error creating SSM client, not caching the token: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		c.logger.Warnf("Error marshaling token for %s: %v", c.name, err)
+		return
+	}
+
+	_, err = client.PutParameter(c.ctx, &ssm.PutParameterInput{
+		Name:      &c.name,
+		Value:     aws.String(string(data)),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		c.logger.Warnf("Error caching token in %s: %v", c.name, err)
+	}
+}
@@ -1,6 +1,7 @@
 from __future__ import annotations
 
 import datetime
+import gzip
 import io
 import json
 import logging
@@ -112,6 +113,8 @@ def create_searchable_text(
 def read_json_from_s3(bucket: str, key: str) -> pl.DataFrame:
     """Read JSON data from S3 and return as a Polars DataFrame.
 
+    Keys ending in .gz are gzip-decompressed before parsing.
+
     Parameters
     ----------
     bucket : str
@@ -132,7 +135,10 @@ def read_json_from_s3(bucket: str, key: str) -> pl.DataFrame:
     """
     try:
         response = s3.get_object(Bucket=bucket, Key=key)
-        content = response["Body"].read().decode("utf-8")
+        body = response["Body"].read()
+        if key.endswith(".gz"):
+            body = gzip.decompress(body)
+        content = body.decode("utf-8")
         json_data = pl.read_json(io.StringIO(content))
     except Exception:
         logger.exception("Error retrieving %s from S3", key)
@@ -141,6 +147,34 @@ def read_json_from_s3(bucket: str, key: str) -> pl.DataFrame:
         return json_data
 
 
+def latest_key(bucket: str, filename: str) -> str:
+    """Resolve the S3 key the latest extraction run wrote a file to.
+
+    Extraction runs write their files under a per-run prefix and record the keys in
+    manifest.json. Buckets written before prefixed keys fall back to the bare file name.
+
+    Parameters
+    ----------
+    bucket : str
+        The S3 bucket name.
+    filename : str
+        The output file name, e.g. games.json.
+
+    Returns
+    -------
+    str
+        The S3 object key holding the latest copy of the file.
+
+    """
+    try:
+        response = s3.get_object(Bucket=bucket, Key="manifest.json")
+        manifest = json.loads(response["Body"].read())
+    except s3.exceptions.NoSuchKey:
+        return filename
+
+    return manifest.get("keys", {}).get(filename, filename)
+
+
 def connect_to_mongodb() -> pymongo.MongoClient:
     """Connect to MongoDB using environment variables for authentication."""
     try:
@@ -187,9 +221,18 @@ def main():
         games_collection = gamesearch_db[mongodb_collection]
 
         # Load raw data from S3 bucket
-        games_df = read_json_from_s3(bucket_name, "games.json")
-        genres_df = read_json_from_s3(bucket_name, "genres.json")
-        franchises_df = read_json_from_s3(bucket_name, "franchises.json")
+        games_df = read_json_from_s3(
+            bucket_name,
+            latest_key(bucket_name, "games.json"),
+        )
+        genres_df = read_json_from_s3(
+            bucket_name,
+            latest_key(bucket_name, "genres.json"),
+        )
+        franchises_df = read_json_from_s3(
+            bucket_name,
+            latest_key(bucket_name, "franchises.json"),
+        )
 
         logger.info(
             "Loaded data: %d games, %d genres, %d franchises",